@@ -0,0 +1,210 @@
+package kyuu
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Mount 和 Handle 注册的 handler 可以处理的 HTTP 方法
+var mountMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// Handle 使用 http.Handler 处理 method 和 path 对应的请求
+// handler 写入的响应会被缓存到 RespStatusCode 和 RespData 里面，所以其它 middleware 依旧可以修改响应
+func (s *HTTPServer) Handle(method string, path string, handler http.Handler) {
+	s.addRoute(method, path, WrapHandler(handler))
+}
+
+// Mount 将 handler 挂载到 prefix 下面，prefix 以及 prefix 下面的所有路径，所有的 HTTP 方法都交给 handler 处理
+// handler 拿到的请求路径去掉了 prefix，例如挂载到 /files，那么 /files/a.txt 到了 handler 那里是 /a.txt
+// 需要完整路径的 handler，例如 net/http/pprof，可以使用 Handle 注册 /debug/pprof/*
+func (s *HTTPServer) Mount(prefix string, handler http.Handler) {
+	newRouteGroup(&s.router, nil, "/", nil).Mount(prefix, handler)
+}
+
+// Handle 和 HTTPServer.Handle 一样，path 会拼接在分组的前缀后面
+func (g *RouteGroup) Handle(method string, path string, handler http.Handler, ms ...Middleware) {
+	g.addRoute(method, path, WrapHandler(handler), ms...)
+}
+
+// Mount 和 HTTPServer.Mount 一样，handler 拿到的请求路径去掉了分组前缀和 prefix
+func (g *RouteGroup) Mount(prefix string, handler http.Handler, ms ...Middleware) {
+	if prefix == "" || prefix[0] != '/' {
+		panic("kyuu: 路由必须以 / 开头")
+	}
+	full := joinPath(g.prefix, prefix)
+	hf := WrapHandler(stripPrefix(full, handler))
+	for _, method := range mountMethods {
+		g.addRoute(method, prefix, hf, ms...)
+		g.addRoute(method, joinPath(prefix, "/*"), hf, ms...)
+	}
+}
+
+// stripPrefix 和 http.StripPrefix 类似，但是去掉前缀之后的路径总是以 / 开头，
+// 并且忽略大小写的时候也可以去掉前缀
+func stripPrefix(prefix string, handler http.Handler) http.Handler {
+	if prefix == "/" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = trimPathPrefix(u.Path, prefix)
+		if u.RawPath != "" {
+			u.RawPath = trimPathPrefix(u.RawPath, prefix)
+		}
+		r2.URL = &u
+		handler.ServeHTTP(w, r2)
+	})
+}
+
+func trimPathPrefix(path string, prefix string) string {
+	if len(path) < len(prefix) || !strings.EqualFold(path[:len(prefix)], prefix) {
+		return path
+	}
+	path = path[len(prefix):]
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	return path
+}
+
+// WrapHandler 将 http.Handler 转换为 HandleFunc
+// handler 写入的响应会被缓存到 RespStatusCode 和 RespData 里面，响应头直接写入 Resp.Header()
+// handler 调用了 Flush 之后会转为流式响应，之后写入的数据直接发送给客户端
+func WrapHandler(handler http.Handler) HandleFunc {
+	return func(ctx *Context) {
+		rb := &responseBuffer{ResponseWriter: ctx.Resp}
+		handler.ServeHTTP(rb, ctx.Req)
+		rb.commit(ctx)
+	}
+}
+
+// FromHTTPMiddleware 将标准库形式的 middleware 转换为 Middleware
+// 标准库的 middleware 替换的 http.Request 和 http.ResponseWriter 在后续的 HandleFunc 里面可以通过 Req 和 Resp 拿到，
+// 后续 HandleFunc 缓存的响应会先经过标准库的 middleware 写入，然后再缓存回 RespStatusCode 和 RespData
+//
+//	s.Use(kyuu.FromHTTPMiddleware(handlers.ProxyHeaders))
+func FromHTTPMiddleware(m func(http.Handler) http.Handler) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			req, resp := ctx.Req, ctx.Resp
+			rb := &responseBuffer{ResponseWriter: resp}
+			m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx.Req, ctx.Resp = r, w
+				next(ctx)
+				if ctx.streaming || ctx.hijacked || ctx.fileServed {
+					// 已经直接写入 w 了
+					return
+				}
+				if ctx.RespStatusCode > 0 {
+					w.WriteHeader(ctx.RespStatusCode)
+				}
+				if len(ctx.RespData) > 0 {
+					_, _ = w.Write(ctx.RespData)
+				}
+			})).ServeHTTP(rb, req)
+			ctx.Req, ctx.Resp = req, resp
+			rb.commit(ctx)
+		}
+	}
+}
+
+// ToHTTPMiddleware 将 Middleware 转换为标准库形式的 middleware，方便在别的框架里面使用
+// Middleware 看到的 RespStatusCode 和 RespData 是 next 写入的响应
+func ToHTTPMiddleware(m Middleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hf := m(WrapHandler(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := &Context{Req: r, Resp: w, encoders: defaultEncoders}
+			hf(ctx)
+			if err := ctx.writeResp(); err != nil {
+				log.Printf("kyuu: 回写响应失败 %s %s %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// responseBuffer 缓存 http.Handler 写入的响应
+type responseBuffer struct {
+	http.ResponseWriter
+	code        int
+	buf         []byte
+	wroteHeader bool
+	// 调用了 Flush 之后直接写入 ResponseWriter
+	flushed  bool
+	hijacked bool
+}
+
+func (w *responseBuffer) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.code = code
+	if w.flushed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.flushed {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	return len(data), nil
+}
+
+// Flush 把缓存的响应发送出去，之后转为流式响应
+func (w *responseBuffer) Flush() {
+	if !w.flushed {
+		w.flushed = true
+		if w.wroteHeader {
+			w.ResponseWriter.WriteHeader(w.code)
+		}
+		if len(w.buf) > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseBuffer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("kyuu: ResponseWriter 不支持 Hijack")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// commit 将缓存的响应写回 ctx
+func (w *responseBuffer) commit(ctx *Context) {
+	switch {
+	case w.hijacked:
+		ctx.hijacked = true
+	case w.flushed:
+		ctx.streaming = true
+		ctx.RespStatusCode = w.code
+	default:
+		ctx.streaming, ctx.fileServed = false, false
+		ctx.RespStatusCode = w.code
+		ctx.RespData = w.buf
+	}
+}
@@ -0,0 +1,199 @@
+package kyuu
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServer_Handle(t *testing.T) {
+	s := NewHTTPServer()
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			// handler 写入的响应依旧可以被 middleware 修改
+			ctx.RespData = append(ctx.RespData, '!')
+		}
+	})
+	s.Handle(http.MethodGet, "/user/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "hello")
+	}))
+	s.Handle(http.MethodGet, "/stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "a")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "b")
+	}))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/user/1", recorder.Header().Get("X-Path"))
+	assert.Equal(t, "hello!", recorder.Body.String())
+
+	// Flush 之后就是流式响应，middleware 不能再修改响应体
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "ab", recorder.Body.String())
+}
+
+func TestHTTPServer_Mount(t *testing.T) {
+	s := NewHTTPServer()
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.Path)
+	})
+	s.Mount("/files", echo)
+	s.Get("/files-list", func(ctx *Context) {
+		ctx.RespString(http.StatusOK, "list")
+	})
+	s.Group("/api").Mount("/legacy", echo)
+	s.Host("static.example.com").Mount("/", echo)
+
+	testCases := []struct {
+		name     string
+		method   string
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "prefix",
+			method:   http.MethodGet,
+			url:      "/files",
+			wantCode: http.StatusOK,
+			wantBody: "GET /",
+		},
+		{
+			name:     "sub path",
+			method:   http.MethodPost,
+			url:      "/files/a/b.txt",
+			wantCode: http.StatusOK,
+			wantBody: "POST /a/b.txt",
+		},
+		{
+			name:     "other route",
+			method:   http.MethodGet,
+			url:      "/files-list",
+			wantCode: http.StatusOK,
+			wantBody: "list",
+		},
+		{
+			name:     "group",
+			method:   http.MethodDelete,
+			url:      "/api/legacy/user/1",
+			wantCode: http.StatusOK,
+			wantBody: "DELETE /user/1",
+		},
+		{
+			name:     "group not found",
+			method:   http.MethodGet,
+			url:      "/api/user",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "root",
+			method:   http.MethodGet,
+			url:      "http://static.example.com/css/app.css",
+			wantCode: http.StatusOK,
+			wantBody: "GET /css/app.css",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestFromHTTPMiddleware(t *testing.T) {
+	type ctxKey struct{}
+	// 修改请求，并且替换 ResponseWriter 给响应体加上前缀
+	std := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("X-Std", "1")
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "std"))
+			next.ServeHTTP(&prefixWriter{ResponseWriter: w}, r)
+		})
+	}
+	s := NewHTTPServer()
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			ctx.RespData = append(ctx.RespData, '!')
+		}
+	}, FromHTTPMiddleware(std))
+	s.Get("/", func(ctx *Context) {
+		ctx.RespString(http.StatusAccepted, ctx.Req.Context().Value(ctxKey{}).(string))
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "token")
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("X-Std"))
+	assert.Equal(t, "> std!", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "unauthorized\n!", recorder.Body.String())
+}
+
+func TestToHTTPMiddleware(t *testing.T) {
+	mdl := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.URL.Path == "/forbidden" {
+				ctx.RespStatusCode = http.StatusForbidden
+				ctx.RespData = []byte("forbidden")
+				return
+			}
+			next(ctx)
+			ctx.RespData = append(ctx.RespData, '!')
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "hello")
+	})
+	h := ToHTTPMiddleware(mdl)(mux)
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "hello!", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/forbidden", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "forbidden", recorder.Body.String())
+}
+
+// prefixWriter 模拟标准库 middleware 替换 ResponseWriter
+type prefixWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *prefixWriter) Write(data []byte) (int, error) {
+	if !w.wrote {
+		w.wrote = true
+		_, _ = io.WriteString(w.ResponseWriter, "> ")
+	}
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,291 @@
+package kyuu
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 解析 multipart 表单的时候，最多使用多少内存，超出的部分会写到临时文件
+const defaultMultipartMemory = 32 << 20
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+	unmarshalerTyp = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// 绑定数据来源对应的 struct tag
+const (
+	tagPath   = "path"
+	tagQuery  = "query"
+	tagForm   = "form"
+	tagHeader = "header"
+)
+
+// Bind 将请求里面的数据绑定到 val 上，val 必须是指向结构体的指针
+//
+//	type Req struct {
+//		ID    int64    `path:"id"`
+//		Page  int      `query:"page"`
+//		Tags  []string `query:"tag"`
+//		Token string   `header:"X-Token"`
+//		Name  string   `json:"name" form:"name"`
+//		Since time.Time `query:"since" time_format:"2006-01-02"`
+//	}
+//
+// 绑定的顺序是：
+// 1. 根据 Content-Type 解析请求体：JSON 和 XML 直接反序列化；
+// 表单和 multipart 表单按照 form 标签绑定，*multipart.FileHeader 类型的字段可以拿到上传的文件
+// 2. 按照 path、query、header 标签，从路径参数、查询参数和请求头里面取值
+// 后面的步骤会覆盖前面步骤的值
+// 3. 设置了 Validator 的时候按照 validate 标签校验，校验失败的时候返回 validate.Errors
+// 支持 string、bool、整数、浮点数、time.Time、time.Duration、实现了 encoding.TextUnmarshaler 的类型，
+// 以及这些类型的指针和切片
+func (c *Context) Bind(val any) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("kyuu: Bind 只支持指向结构体的指针")
+	}
+
+	if err := c.bindBody(val); err != nil {
+		return err
+	}
+
+	if len(c.PathParams) > 0 {
+		if err := bindStruct(rv.Elem(), tagPath, func(key string) []string {
+			v, ok := c.PathParams[key]
+			if !ok {
+				return nil
+			}
+			return []string{v}
+		}); err != nil {
+			return err
+		}
+	}
+
+	if c.queryValues == nil {
+		c.queryValues = c.Req.URL.Query()
+	}
+	if err := bindStruct(rv.Elem(), tagQuery, func(key string) []string {
+		return c.queryValues[key]
+	}); err != nil {
+		return err
+	}
+
+	if err := bindStruct(rv.Elem(), tagHeader, c.Req.Header.Values); err != nil {
+		return err
+	}
+	return c.validate(val)
+}
+
+func (c *Context) bindBody(val any) error {
+	contentType := c.Req.Header.Get("Content-Type")
+	if c.Req.Body == nil || contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("kyuu: 非法的 Content-Type %w", err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		return ignoreEOF(json.NewDecoder(c.Req.Body).Decode(val))
+	case "application/xml", "text/xml":
+		return ignoreEOF(xml.NewDecoder(c.Req.Body).Decode(val))
+	case "application/x-www-form-urlencoded":
+		if err = c.Req.ParseForm(); err != nil {
+			return err
+		}
+	case "multipart/form-data":
+		if err = c.Req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	rv := reflect.ValueOf(val).Elem()
+	if err = bindStruct(rv, tagForm, func(key string) []string {
+		return c.Req.Form[key]
+	}); err != nil {
+		return err
+	}
+	if c.Req.MultipartForm != nil {
+		return bindFiles(rv, c.Req.MultipartForm.File)
+	}
+	return nil
+}
+
+// ignoreEOF 请求体为空的时候不认为是错误
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// bindStruct 按照 tag 从 lookup 里面取值，设置到结构体的字段上
+// lookup 找不到值的时候返回 nil，字段保持原样
+// 没有 tag 的结构体字段（包括组合）会被递归处理
+func bindStruct(rv reflect.Value, tag string, lookup func(key string) []string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		fd := rt.Field(i)
+		// 非公开的组合结构体，它的公开字段依旧可以被设置
+		if !fd.IsExported() && !fd.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		key, ok := fd.Tag.Lookup(tag)
+		if !ok {
+			if fd.Type.Kind() == reflect.Struct && fd.Type != timeType {
+				if err := bindStruct(fv, tag, lookup); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+		vals := lookup(key)
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setField(fv, vals, fd.Tag.Get("time_format")); err != nil {
+			return fmt.Errorf("kyuu: 字段 %s 绑定失败 %w", fd.Name, err)
+		}
+	}
+	return nil
+}
+
+// bindFiles 将上传的文件绑定到 *multipart.FileHeader 或者 []*multipart.FileHeader 类型的字段上
+func bindFiles(rv reflect.Value, files map[string][]*multipart.FileHeader) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		fd := rt.Field(i)
+		// 非公开的组合结构体，它的公开字段依旧可以被设置
+		if !fd.IsExported() && !fd.Anonymous {
+			continue
+		}
+		key := fd.Tag.Get(tagForm)
+		fhs := files[key]
+		switch {
+		case key == "" && fd.Type.Kind() == reflect.Struct && fd.Type != timeType:
+			if err := bindFiles(rv.Field(i), files); err != nil {
+				return err
+			}
+		case len(fhs) == 0:
+		case fd.Type == fileHeaderType:
+			rv.Field(i).Set(reflect.ValueOf(fhs[0]))
+		case fd.Type.Kind() == reflect.Slice && fd.Type.Elem() == fileHeaderType:
+			rv.Field(i).Set(reflect.ValueOf(fhs))
+		}
+	}
+	return nil
+}
+
+// setField 设置字段的值，切片会使用所有的值，其它类型只使用第一个值
+func setField(fv reflect.Value, vals []string, layout string) error {
+	if fv.Type() == fileHeaderType ||
+		(fv.Kind() == reflect.Slice && fv.Type().Elem() == fileHeaderType) {
+		// 文件由 bindFiles 处理
+		return nil
+	}
+	if fv.Kind() == reflect.Slice && !isTextUnmarshaler(fv) {
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, v := range vals {
+			if err := setValue(slice.Index(i), v, layout); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, vals[0], layout)
+}
+
+// setValue 将字符串转换为 v 的类型，并且设置到 v 上
+// layout 只对 time.Time 有效，默认是 time.RFC3339
+func setValue(v reflect.Value, val string, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), val, layout); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	if isTextUnmarshaler(v) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+
+	switch v.Type() {
+	case timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// isTextUnmarshaler time.Time 也实现了 encoding.TextUnmarshaler，但是我们希望支持自定义 layout
+func isTextUnmarshaler(v reflect.Value) bool {
+	return v.Type() != timeType && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(unmarshalerTyp)
+}
@@ -0,0 +1,290 @@
+package kyuu
+
+import (
+	"bytes"
+	"errors"
+	"github.com/coderi421/kyuu/validate"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindUser struct {
+	ID       int64                 `path:"id"`
+	Page     int                   `query:"page"`
+	Size     *uint8                `query:"size"`
+	Tags     []string              `query:"tag"`
+	IDs      []int                 `query:"ids"`
+	Ratio    float64               `query:"ratio"`
+	Debug    bool                  `query:"debug"`
+	Since    time.Time             `query:"since" time_format:"2006-01-02"`
+	Until    *time.Time            `query:"until"`
+	Timeout  time.Duration         `query:"timeout"`
+	Trace    uuid.UUID             `header:"X-Trace-Id"`
+	Token    string                `header:"X-Token"`
+	Name     string                `json:"name" xml:"name" form:"name"`
+	Email    string                `json:"email" xml:"email" form:"email"`
+	Ignored  string                `query:"-"`
+	internal string                `query:"internal"`
+	Avatar   *multipart.FileHeader `form:"avatar"`
+	bindPaging
+}
+
+type bindPaging struct {
+	Offset int `query:"offset"`
+}
+
+func TestContext_Bind(t *testing.T) {
+	size := uint8(20)
+	since := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	traceID := uuid.MustParse("0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11")
+
+	testCases := []struct {
+		name       string
+		req        func() *http.Request
+		pathParams map[string]string
+		wantVal    bindUser
+		wantErr    error
+	}{
+		{
+			name: "path query header",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet,
+					"/user/123?page=2&size=20&tag=a&tag=b&ids=1&ids=2&ratio=0.5&debug=true"+
+						"&since=2023-05-01&until=2023-06-01T12:30:00Z&timeout=1m30s&offset=10&internal=x&-=y", nil)
+				req.Header.Set("X-Token", "abc")
+				req.Header.Set("X-Trace-Id", traceID.String())
+				return req
+			},
+			pathParams: map[string]string{"id": "123"},
+			wantVal: bindUser{
+				ID:         123,
+				Page:       2,
+				Size:       &size,
+				Tags:       []string{"a", "b"},
+				IDs:        []int{1, 2},
+				Ratio:      0.5,
+				Debug:      true,
+				Since:      since,
+				Until:      &until,
+				Timeout:    time.Minute + time.Second*30,
+				Trace:      traceID,
+				Token:      "abc",
+				bindPaging: bindPaging{Offset: 10},
+			},
+		},
+		{
+			name: "json",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user?page=1",
+					strings.NewReader(`{"name":"Tom","email":"tom@example.com"}`))
+				req.Header.Set("Content-Type", "application/json; charset=utf-8")
+				return req
+			},
+			wantVal: bindUser{Page: 1, Name: "Tom", Email: "tom@example.com"},
+		},
+		{
+			name: "empty json body",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user?page=1", nil)
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			wantVal: bindUser{Page: 1},
+		},
+		{
+			name: "xml",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user",
+					strings.NewReader(`<user><name>Tom</name><email>tom@example.com</email></user>`))
+				req.Header.Set("Content-Type", "application/xml")
+				return req
+			},
+			wantVal: bindUser{Name: "Tom", Email: "tom@example.com"},
+		},
+		{
+			name: "form",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user",
+					strings.NewReader("name=Tom&email=tom%40example.com"))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return req
+			},
+			wantVal: bindUser{Name: "Tom", Email: "tom@example.com"},
+		},
+		{
+			name: "invalid int",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/user?page=abc", nil)
+			},
+			wantErr: errors.New(`kyuu: 字段 Page 绑定失败 strconv.ParseInt: parsing "abc": invalid syntax`),
+		},
+		{
+			name: "overflow",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/user?size=256", nil)
+			},
+			wantErr: errors.New(`kyuu: 字段 Size 绑定失败 strconv.ParseUint: parsing "256": value out of range`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := &Context{Req: tc.req(), PathParams: tc.pathParams}
+			var u bindUser
+			err := ctx.Bind(&u)
+			if tc.wantErr != nil {
+				assert.EqualError(t, err, tc.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVal, u)
+		})
+	}
+}
+
+func TestContext_BindMultipart(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("name", "Tom"))
+	fw, err := writer.CreateFormFile("avatar", "avatar.png")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("png data"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/user?page=3", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	ctx := &Context{Req: req}
+	var u bindUser
+	require.NoError(t, ctx.Bind(&u))
+	assert.Equal(t, "Tom", u.Name)
+	assert.Equal(t, 3, u.Page)
+	require.NotNil(t, u.Avatar)
+	assert.Equal(t, "avatar.png", u.Avatar.Filename)
+	f, err := u.Avatar.Open()
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "png data", string(data))
+}
+
+func TestContext_BindInvalidTarget(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}
+	var u bindUser
+	for _, val := range []any{nil, u, (*bindUser)(nil), new(int)} {
+		assert.EqualError(t, ctx.Bind(val), "kyuu: Bind 只支持指向结构体的指针")
+	}
+}
+
+type signUpReq struct {
+	ID       int64  `path:"id" validate:"gt=0"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+func TestContext_BindValidate(t *testing.T) {
+	s := NewHTTPServer(ServerWithValidator(validate.Default))
+	handler := func(bind func(ctx *Context, val any) error) HandleFunc {
+		return func(ctx *Context) {
+			var req signUpReq
+			if err := bind(ctx, &req); err != nil {
+				var errs validate.Errors
+				if errors.As(err, &errs) {
+					_ = ctx.RespJSON(http.StatusBadRequest, errs)
+					return
+				}
+				ctx.RespStatusCode = http.StatusInternalServerError
+				return
+			}
+			ctx.RespStatusCode = http.StatusOK
+		}
+	}
+	s.Post("/bind/:id", handler((*Context).Bind))
+	s.Post("/json", handler((*Context).BindJSON))
+
+	testCases := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "bind",
+			path:     "/bind/1",
+			body:     `{"email":"tom@example.com","password":"12345678"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "bind invalid",
+			path:     "/bind/0",
+			body:     `{"email":"tom","password":"12345678"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `[{"field":"ID","rule":"gt","param":"0","message":"ID 必须大于 0"},` +
+				`{"field":"email","rule":"email","message":"email 不是合法的邮箱"}]`,
+		},
+		{
+			name:     "bind json invalid",
+			path:     "/json",
+			body:     `{"email":"tom@example.com"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `[{"field":"ID","rule":"gt","param":"0","message":"ID 必须大于 0"},` +
+				`{"field":"password","rule":"required","message":"password 不能为空"}]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+type alwaysFail struct{}
+
+func (alwaysFail) ValidateStruct(val any) error {
+	return errors.New("mock error")
+}
+
+func TestServerWithValidator(t *testing.T) {
+	s := NewHTTPServer(ServerWithValidator(alwaysFail{}))
+	var err error
+	s.Post("/json", func(ctx *Context) {
+		err = ctx.BindJSON(&signUpReq{})
+	})
+	req := httptest.NewRequest(http.MethodPost, "/json", strings.NewReader(`{}`))
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	assert.EqualError(t, err, "mock error")
+}
+
+type goPlaygroundReq struct {
+	Tags []string `json:"tags" validate:"dive,required"`
+}
+
+func TestContext_BindJSON_withoutValidator(t *testing.T) {
+	// 没有设置 Validator 的时候不校验，别的校验库的标签不会导致绑定失败
+	s := NewHTTPServer()
+	var err error
+	var req goPlaygroundReq
+	s.Post("/json", func(ctx *Context) {
+		err = ctx.BindJSON(&req)
+	})
+	s.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/json", strings.NewReader(`{"tags":["a"]}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, req.Tags)
+}
@@ -1,11 +1,15 @@
 package kyuu
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
+	"time"
 )
 
 // Context is the interface that wraps the basic ServeHTTP method.
@@ -32,6 +36,10 @@ type Context struct {
 
 	// 通过 ctx 将 template engine 传递下去
 	tplEngine TemplateEngine
+	// 绑定数据之后用来校验
+	validator Validator
+	// 处理 HandleFuncE 和 Error 的 error
+	errHandler ErrorHandler
 
 	// 用户可以自由决定在这里存储什么，
 	// 主要用于解决在不同 Middleware 之间数据传递的问题
@@ -39,8 +47,77 @@ type Context struct {
 	// 1. UserValues 在初始状态的时候总是 nil，你需要自己手动初始化
 	// 懒汉模式 => 在第一次使用的时候初始化
 	UserValues map[string]any
+
+	// 流式响应模式下，数据直接写入 Resp，RespData 不再生效
+	streaming bool
+	// 连接被接管之后，框架不再回写响应
+	hijacked bool
+	// RespFile 已经将文件直接写入 Resp
+	fileServed bool
+	// 调用了 Abort 之后，后续的 middleware 和业务逻辑不再执行
+	aborted bool
+	// 内容协商可以使用的格式
+	encoders []encoderEntry
+
+	// 类型参数转换之后的值，通过 TypedPathValue 读取
+	typedParams map[string]any
+
+	// 路由匹配的结果，跟随 Context 一起复用
+	mi matchInfo
+}
+
+// Clone 复制一份 Context，用于在别的 goroutine 里面继续处理请求，例如超时控制
+// 复制出来的 Context 不会被放回池子里面，PathParams 和 UserValues 也是复制的，
+// 所以两边修改这两个 map 不会互相影响
+func (c *Context) Clone() *Context {
+	cp := *c
+	cp.mi = matchInfo{}
+	if c.PathParams != nil {
+		cp.PathParams = make(map[string]string, len(c.PathParams))
+		for k, v := range c.PathParams {
+			cp.PathParams[k] = v
+		}
+	}
+	if c.typedParams != nil {
+		cp.typedParams = make(map[string]any, len(c.typedParams))
+		for k, v := range c.typedParams {
+			cp.typedParams[k] = v
+		}
+	}
+	if c.UserValues != nil {
+		cp.UserValues = make(map[string]any, len(c.UserValues))
+		for k, v := range c.UserValues {
+			cp.UserValues[k] = v
+		}
+	}
+	return &cp
+}
+
+// reset 清空 Context 以便放回池子里面复用
+func (c *Context) reset() {
+	mi := c.mi
+	mi.reset()
+	*c = Context{mi: mi}
 }
 
+// Abort 中断处理，后续的 middleware 和业务逻辑都不会执行，即便当前 middleware 依旧调用了 next
+// 已经在执行的 middleware 不受影响，它们在 next 返回之后的逻辑照常执行，可以通过 IsAborted 判断
+func (c *Context) Abort() {
+	c.aborted = true
+}
+
+// AbortWithStatus 设置响应码并且中断处理
+func (c *Context) AbortWithStatus(code int) {
+	c.RespStatusCode = code
+	c.Abort()
+}
+
+// IsAborted 是否调用过 Abort
+func (c *Context) IsAborted() bool {
+	return c.aborted
+}
+
+// BindJSON 将请求体反序列化到 val 上，设置了 Validator 的时候再按照 validate 标签校验
 func (c *Context) BindJSON(val any) error {
 	if c.Req.Body == nil {
 		return errors.New("kyuu: body 为 nil")
@@ -57,7 +134,11 @@ func (c *Context) BindJSON(val any) error {
 	// 比如说你 User 只有 Name 和 Email 两个字段
 	// JSON 里面额外多了一个 Age 字段，那么就会报错
 	// decoder.DisallowUnknownFields()
-	return decoder.Decode(val)
+	if err := decoder.Decode(val); err != nil {
+		return err
+	}
+	// 校验失败的时候返回 validate.Errors，可以直接作为 400 的响应返回
+	return c.validate(val)
 }
 
 func (c *Context) Render(tplName string, data any) error {
@@ -74,15 +155,19 @@ func (c *Context) Render(tplName string, data any) error {
 	return nil
 }
 
+// ErrKeyNotFound 查询参数、表单或者路径参数里面没有这个 key
+var ErrKeyNotFound = errors.New("kyuu: 找不到这个 key")
+
 // FormValue returns the first value for the named component of the query.
+// 和 QueryValue 一样，key 不存在的时候返回 ErrKeyNotFound
 func (c *Context) FormValue(key string) StringValue {
-	// ParseForm parses the raw query from the URL and updates r.Form.
-	// 必须要先 ParseForm 才能使用 FormValue
-	err := c.Req.ParseForm()
-	if err != nil {
+	// ParseMultipartForm 会先调用 ParseForm，不是 multipart 的请求只解析查询参数和 urlencoded 表单
+	// 和 http.Request.FormValue 一样，multipart 表单的字段也放在 Form 里面
+	err := c.Req.ParseMultipartForm(defaultMultipartMemory)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		return StringValue{err: err}
 	}
-	return StringValue{val: c.Req.FormValue(key)}
+	return newStringValue(c.Req.Form[key])
 }
 
 // QueryValue Query 和表单比起来，它没有缓存，所以需要自己缓存起来，不然每次都要解析
@@ -90,25 +175,32 @@ func (c *Context) QueryValue(key string) StringValue {
 	if c.queryValues == nil {
 		c.queryValues = c.Req.URL.Query()
 	}
-
-	vals, ok := c.queryValues[key]
-	if !ok {
-		return StringValue{err: errors.New("kyuu: 找不到这个 key")}
-	}
-	if len(vals) == 1 {
-		return StringValue{val: vals[0]}
-	}
-	return StringValue{multiVal: vals}
 	// 用户区别不出来是真的有值，但是值恰好是空字符串
-	// 还是没有值
-	// return c.queryValues.Get(key), nil
+	// 还是没有值，所以没有值的时候返回 ErrKeyNotFound
+	return newStringValue(c.queryValues[key])
 }
+
 func (c *Context) PathValue(key string) StringValue {
 	val, ok := c.PathParams[key]
 	if !ok {
-		return StringValue{err: errors.New("web: 找不到这个 key")}
+		return StringValue{err: ErrKeyNotFound}
 	}
-	return StringValue{val: val}
+	return StringValue{val: val, multiVal: []string{val}}
+}
+
+// Hijack 接管底层的 TCP 连接，例如升级到 WebSocket
+// 接管之后框架不会再回写响应，连接的生命周期由调用者负责
+func (c *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := c.Resp.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("kyuu: ResponseWriter 不支持 Hijack")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.hijacked = true
+	return conn, rw, nil
 }
 
 func (c *Context) SetCookie(cookie *http.Cookie) {
@@ -126,17 +218,25 @@ func (c *Context) RespJSON(code int, val any) error {
 	// c.Resp.WriteHeader(code)
 	//	_, err = c.Resp.Write(bs)
 	// 这里缓存起来，为了 after hook 处理方便
-	c.RespStatusCode = code
-	c.RespData = bs
-	return err
+	c.RespBytes(code, "application/json", bs)
+	return nil
 }
 
+// StringValue 查询参数、表单和路径参数的值
+// 有多个值的时候，String 和 ToXXX 使用第一个值，StringMultiVal 和 ToXXXSlice 使用所有的值
 type StringValue struct {
 	val      string
 	multiVal []string
 	err      error
 }
 
+func newStringValue(vals []string) StringValue {
+	if len(vals) == 0 {
+		return StringValue{err: ErrKeyNotFound}
+	}
+	return StringValue{val: vals[0], multiVal: vals}
+}
+
 func (s StringValue) String() (string, error) {
 	return s.val, s.err
 }
@@ -145,9 +245,99 @@ func (s StringValue) StringMultiVal() ([]string, error) {
 	return s.multiVal, s.err
 }
 
+// Or 没有值或者出错的时候返回 def
+func (s StringValue) Or(def string) string {
+	if s.err != nil {
+		return def
+	}
+	return s.val
+}
+
 func (s StringValue) ToInt64() (int64, error) {
 	if s.err != nil {
 		return 0, s.err
 	}
 	return strconv.ParseInt(s.val, 10, 64)
 }
+
+func (s StringValue) ToUint64() (uint64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseUint(s.val, 10, 64)
+}
+
+func (s StringValue) ToFloat64() (float64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return strconv.ParseFloat(s.val, 64)
+}
+
+// ToBool 支持 1、t、T、TRUE、true、True、0、f、F、FALSE、false、False
+func (s StringValue) ToBool() (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	return strconv.ParseBool(s.val)
+}
+
+// ToDuration 支持 time.ParseDuration 的格式，例如 1m30s
+func (s StringValue) ToDuration() (time.Duration, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return time.ParseDuration(s.val)
+}
+
+// ToTime 按照 layout 解析时间，例如 time.RFC3339、"2006-01-02"
+func (s StringValue) ToTime(layout string) (time.Time, error) {
+	if s.err != nil {
+		return time.Time{}, s.err
+	}
+	return time.Parse(layout, s.val)
+}
+
+// ToInt64Slice 将所有的值转换为 int64，任何一个值转换失败都会返回 error
+func (s StringValue) ToInt64Slice() ([]int64, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	res := make([]int64, 0, len(s.multiVal))
+	for _, v := range s.multiVal {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// As 将 StringValue 转换为 T，支持的类型和 Context.Bind 一样：
+// string、bool、整数、浮点数、time.Time（RFC3339）、time.Duration、实现了 encoding.TextUnmarshaler 的类型，
+// 以及这些类型的指针和切片，切片会使用所有的值
+//
+//	id, err := kyuu.As[uint32](ctx.PathValue("id"))
+//	ids, err := kyuu.As[[]int](ctx.QueryValue("id"))
+func As[T any](s StringValue) (T, error) {
+	var t T
+	if s.err != nil {
+		return t, s.err
+	}
+	if err := setField(reflect.ValueOf(&t).Elem(), s.multiVal, ""); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// AsOr 和 As 一样，但是没有值或者转换失败的时候返回 def
+//
+//	page := kyuu.AsOr(ctx.QueryValue("page"), 1)
+func AsOr[T any](s StringValue, def T) T {
+	t, err := As[T](s)
+	if err != nil {
+		return def
+	}
+	return t
+}
@@ -0,0 +1,128 @@
+package kyuu
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContext_Values(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/user/123?id=1&id=2&debug=true&ratio=0.5",
+		strings.NewReader("since=2023-05-01&timeout=1m30s&id=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := &Context{Req: req, PathParams: map[string]string{"id": "123"}}
+
+	// query
+	id, err := ctx.QueryValue("id").ToInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	ids, err := ctx.QueryValue("id").ToInt64Slice()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+	vals, err := ctx.QueryValue("id").StringMultiVal()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, vals)
+	debug, err := ctx.QueryValue("debug").ToBool()
+	require.NoError(t, err)
+	assert.True(t, debug)
+	ratio, err := ctx.QueryValue("ratio").ToFloat64()
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, ratio)
+	_, err = ctx.QueryValue("missing").ToBool()
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, "default", ctx.QueryValue("missing").Or("default"))
+
+	// form
+	since, err := ctx.FormValue("since").ToTime("2006-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), since)
+	timeout, err := ctx.FormValue("timeout").ToDuration()
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute+time.Second*30, timeout)
+	// 表单里面也包含了查询参数
+	_, err = ctx.FormValue("id").ToInt64Slice()
+	assert.EqualError(t, err, `strconv.ParseInt: parsing "abc": invalid syntax`)
+	_, err = ctx.FormValue("missing").String()
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// path
+	uid, err := ctx.PathValue("id").ToUint64()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123), uid)
+	assert.Equal(t, "123", ctx.PathValue("id").Or("0"))
+	_, err = ctx.PathValue("missing").ToUint64()
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestContext_FormValue_multipart(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("name", "tom"))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/user?id=1", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	ctx := &Context{Req: req}
+
+	name, err := ctx.FormValue("name").String()
+	require.NoError(t, err)
+	assert.Equal(t, "tom", name)
+	id, err := ctx.FormValue("id").ToInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	_, err = ctx.FormValue("missing").String()
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestAs(t *testing.T) {
+	traceID := uuid.MustParse("0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11")
+	req := httptest.NewRequest(http.MethodGet,
+		"/?id=1&id=2&size=300&trace="+traceID.String()+"&at=2023-05-01T00:00:00Z", nil)
+	ctx := &Context{Req: req}
+
+	id, err := As[uint32](ctx.QueryValue("id"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), id)
+
+	ids, err := As[[]int](ctx.QueryValue("id"))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+
+	trace, err := As[uuid.UUID](ctx.QueryValue("trace"))
+	require.NoError(t, err)
+	assert.Equal(t, traceID, trace)
+
+	at, err := As[*time.Time](ctx.QueryValue("at"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), *at)
+
+	_, err = As[uint8](ctx.QueryValue("size"))
+	assert.EqualError(t, err, `strconv.ParseUint: parsing "300": value out of range`)
+	_, err = As[int](ctx.QueryValue("missing"))
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+
+	assert.Equal(t, uint8(10), AsOr(ctx.QueryValue("size"), uint8(10)))
+	assert.Equal(t, 20, AsOr(ctx.QueryValue("missing"), 20))
+	assert.Equal(t, 1, AsOr(ctx.QueryValue("id"), 20))
+}
+
+func TestContext_Clone(t *testing.T) {
+	ctx := &Context{
+		Req:        httptest.NewRequest(http.MethodGet, "/user/123", nil),
+		PathParams: map[string]string{"id": "123"},
+		UserValues: map[string]any{"user": "Tom"},
+	}
+	cp := ctx.Clone()
+	cp.PathParams["id"] = "456"
+	cp.UserValues["user"] = "Jerry"
+	assert.Equal(t, "123", ctx.PathParams["id"])
+	assert.Equal(t, "Tom", ctx.UserValues["user"])
+	assert.Equal(t, ctx.Req, cp.Req)
+}
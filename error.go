@@ -0,0 +1,114 @@
+package kyuu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coderi421/kyuu/validate"
+	"log"
+	"net/http"
+)
+
+// HandleFuncE 返回 error 的业务逻辑，通过 WrapE 转换为 HandleFunc 之后注册
+//
+//	s.Get("/user/:id", kyuu.WrapE(func(ctx *kyuu.Context) error {
+//		id, err := ctx.PathValue("id").ToInt64()
+//		if err != nil {
+//			return kyuu.NewHTTPError(http.StatusBadRequest, "id 必须是数字", err)
+//		}
+//		u, err := dao.GetUser(ctx.Req.Context(), id)
+//		if err != nil {
+//			return err
+//		}
+//		return ctx.RespJSONOK(u)
+//	}))
+type HandleFuncE func(ctx *Context) error
+
+// ErrorHandler 将业务逻辑返回的 error 转换为响应
+type ErrorHandler func(ctx *Context, err error)
+
+// WrapE 将 HandleFuncE 转换为 HandleFunc，返回的 error 交给 ServerWithErrorHandler 设置的 ErrorHandler 处理
+func WrapE(handler HandleFuncE) HandleFunc {
+	return func(ctx *Context) {
+		if err := handler(ctx); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
+// Error 将 err 交给 ServerWithErrorHandler 设置的 ErrorHandler 处理，没有设置的时候使用 DefaultErrorHandler
+// 普通的 HandleFunc 和 middleware 也可以用它来统一处理错误
+func (c *Context) Error(err error) {
+	if c.errHandler != nil {
+		c.errHandler(c, err)
+		return
+	}
+	DefaultErrorHandler(c, err)
+}
+
+// ServerWithErrorHandler 设置 HandleFuncE 和 Context.Error 使用的 ErrorHandler
+func ServerWithErrorHandler(handler ErrorHandler) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.errHandler = handler
+	}
+}
+
+// HTTPError 带有响应码的 error
+// Message 会作为响应返回给前端，Cause 只用于记录日志，不会返回给前端
+type HTTPError struct {
+	Code    int
+	Message string
+	Cause   error
+}
+
+// NewHTTPError 创建 HTTPError，message 为空的时候使用 http.StatusText(code)
+func NewHTTPError(code int, message string, cause error) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message, Cause: cause}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("kyuu: %d %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("kyuu: %d %s", e.Code, e.Message)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Cause
+}
+
+// DefaultErrorHandler 默认的 ErrorHandler
+//   - HTTPError 使用它的 Code 和 Message 作为响应，没有设置 Code 的时候响应 500
+//   - validate.Errors 响应 400，响应体是 JSON 格式的校验失败信息
+//   - ErrNotAcceptable 响应 406
+//   - 其它的 error 响应 500，error 本身只记录日志，不会返回给前端
+func DefaultErrorHandler(ctx *Context, err error) {
+	var httpErr *HTTPError
+	var validateErrs validate.Errors
+	switch {
+	case errors.As(err, &httpErr):
+		code, msg := httpErr.Code, httpErr.Message
+		// 直接构造的 HTTPError 可能没有设置 Code，不能当成 200 返回
+		if code == 0 {
+			code = http.StatusInternalServerError
+			if msg == "" {
+				msg = http.StatusText(code)
+			}
+		}
+		if code >= http.StatusInternalServerError {
+			log.Printf("kyuu: 处理请求 %s %s 失败 %v", ctx.Req.Method, ctx.Req.URL.Path, err)
+		}
+		ctx.RespString(code, msg)
+	case errors.As(err, &validateErrs):
+		if er := ctx.RespJSON(http.StatusBadRequest, validateErrs); er != nil {
+			ctx.RespString(http.StatusBadRequest, validateErrs.Error())
+		}
+	case errors.Is(err, ErrNotAcceptable):
+		ctx.RespString(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+	default:
+		log.Printf("kyuu: 处理请求 %s %s 失败 %v", ctx.Req.Method, ctx.Req.URL.Path, err)
+		ctx.RespString(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
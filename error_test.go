@@ -0,0 +1,115 @@
+package kyuu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/coderi421/kyuu/validate"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrapE(t *testing.T) {
+	errDB := errors.New("db error")
+	testCases := []struct {
+		name     string
+		opts     []HTTPServerOption
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "no error",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:     "http error",
+			err:      NewHTTPError(http.StatusBadRequest, "id 必须是数字", errDB),
+			wantCode: http.StatusBadRequest,
+			wantBody: "id 必须是数字",
+		},
+		{
+			name:     "wrapped http error",
+			err:      fmt.Errorf("get user: %w", NewHTTPError(http.StatusNotFound, "", nil)),
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "http error without code",
+			err:      &HTTPError{Cause: errDB},
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Server Error",
+		},
+		{
+			name: "validate errors",
+			err: validate.Errors{
+				{Field: "name", Rule: "required", Message: "name 不能为空"},
+			},
+			wantCode: http.StatusBadRequest,
+			wantBody: `[{"field":"name","rule":"required","message":"name 不能为空"}]`,
+		},
+		{
+			// 其它的 error 不会返回给前端
+			name:     "other error",
+			err:      errDB,
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Server Error",
+		},
+		{
+			name: "custom error handler",
+			opts: []HTTPServerOption{ServerWithErrorHandler(func(ctx *Context, err error) {
+				ctx.RespString(http.StatusTeapot, err.Error())
+			})},
+			err:      errDB,
+			wantCode: http.StatusTeapot,
+			wantBody: "db error",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			s.Get("/", WrapE(func(ctx *Context) error {
+				if tc.err != nil {
+					return tc.err
+				}
+				ctx.RespString(http.StatusOK, "ok")
+				return nil
+			}))
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	errDB := errors.New("db error")
+	err := NewHTTPError(http.StatusServiceUnavailable, "", errDB)
+	assert.Equal(t, "Service Unavailable", err.Message)
+	assert.Equal(t, "kyuu: 503 Service Unavailable: db error", err.Error())
+	assert.True(t, errors.Is(err, errDB))
+	assert.Equal(t, "kyuu: 400 bad", NewHTTPError(http.StatusBadRequest, "bad", nil).Error())
+}
+
+// errWriter 模拟客户端断开连接之后写入失败
+type errWriter struct {
+	nopResponseWriter
+}
+
+func (w *errWriter) Write(data []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestHTTPServer_flashRespError(t *testing.T) {
+	s := NewHTTPServer()
+	s.Get("/", func(ctx *Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	// 回写失败只记录日志，不会退出
+	assert.NotPanics(t, func() {
+		s.ServeHTTP(&errWriter{nopResponseWriter{header: http.Header{}}}, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,119 @@
+package kyuu
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RouteGroup 路由分组
+// 同一个分组下的路由共享前缀 prefix 和 middleware
+// 分组的 middleware 会挂载到 prefix 对应的路由树节点上，
+// 所以只有命中了 prefix 的请求才会执行这些 middleware
+type RouteGroup struct {
+	// 路由注册到哪一棵路由树上，默认的路由树或者某个域名的路由树
+	r      *router
+	parent *RouteGroup
+	prefix string
+	mdls   []Middleware
+	// 记录已经在哪些 HTTP 方法的路由树上挂载过 middleware
+	// 分组的 middleware 是在第一次注册该方法的路由时才挂载的，
+	// 避免为没有用到的方法创建路由树
+	mounted map[string]bool
+}
+
+// Group 创建一个路由分组
+// prefix 必须以 / 开始并且结尾不能有 /
+func (s *HTTPServer) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(&s.router, nil, prefix, mdls)
+}
+
+// Group 创建嵌套的路由分组，前缀会拼接在当前分组的前缀之后
+// 外层分组的 middleware 会先于内层分组的 middleware 执行
+func (g *RouteGroup) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(g.r, g, joinPath(g.prefix, prefix), mdls)
+}
+
+func newRouteGroup(r *router, parent *RouteGroup, prefix string, mdls []Middleware) *RouteGroup {
+	if prefix == "" || prefix[0] != '/' {
+		panic(fmt.Sprintf("kyuu: 分组前缀必须以 / 开头 [%s]", prefix))
+	}
+	if prefix != "/" && prefix[len(prefix)-1] == '/' {
+		panic(fmt.Sprintf("kyuu: 分组前缀不能以 / 结尾 [%s]", prefix))
+	}
+	return &RouteGroup{
+		r:       r,
+		parent:  parent,
+		prefix:  prefix,
+		mdls:    mdls,
+		mounted: map[string]bool{},
+	}
+}
+
+// mount 将当前分组以及所有上层分组的 middleware 挂载到 method 对应的路由树上
+func (g *RouteGroup) mount(method string) {
+	if g.parent != nil {
+		g.parent.mount(method)
+	}
+	if g.mounted[method] {
+		return
+	}
+	g.mounted[method] = true
+	if len(g.mdls) > 0 {
+		g.r.addMiddlewares(method, g.prefix, g.mdls...)
+	}
+}
+
+func (g *RouteGroup) addRoute(method string, path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.NamedRoute("", method, path, handleFunc, ms...)
+}
+
+// NamedRoute 在分组下注册一个命名路由，名字在整个 HTTPServer 内都不能重复
+func (g *RouteGroup) NamedRoute(name string, method string, path string, handleFunc HandleFunc, ms ...Middleware) {
+	if path != "" && path[0] != '/' {
+		panic("kyuu: 路由必须以 / 开头")
+	}
+	g.mount(method)
+	g.r.addNamedRoute(name, method, joinPath(g.prefix, path), handleFunc, ms...)
+}
+
+func (g *RouteGroup) Get(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodGet, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Post(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodPost, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Put(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodPut, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Delete(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodDelete, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Patch(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodPatch, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Options(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodOptions, path, handleFunc, ms...)
+}
+
+func (g *RouteGroup) Head(path string, handleFunc HandleFunc, ms ...Middleware) {
+	g.addRoute(http.MethodHead, path, handleFunc, ms...)
+}
+
+// joinPath 拼接分组前缀和路由
+// /api + /user => /api/user
+// /api + / => /api
+// / + /user => /user
+func joinPath(prefix, path string) string {
+	if path == "" || path == "/" {
+		return prefix
+	}
+	if prefix == "/" {
+		return path
+	}
+	return prefix + path
+}
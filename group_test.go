@@ -0,0 +1,124 @@
+package kyuu
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteGroup(t *testing.T) {
+	var mdlBuilder = func(i byte) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.RespData = append(ctx.RespData, i)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = append(ctx.RespData, '!')
+	}
+
+	s := NewHTTPServer()
+	s.Get("/api", handler)
+	s.Get("/other", handler)
+
+	api := s.Group("/api", mdlBuilder('a'))
+	api.Post("/login", handler)
+
+	v1 := api.Group("/v1", mdlBuilder('v'))
+	v1.Get("/users/:id", handler, mdlBuilder('u'))
+	v1.Post("/users", handler)
+	// 注册在分组前缀上的路由，不会覆盖分组的 middleware
+	api.Group("/v2", mdlBuilder('2')).Get("/", handler)
+
+	root := s.Group("/", mdlBuilder('r'))
+	root.Get("/home", handler)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantResp string
+	}{
+		{
+			name:     "group prefix",
+			method:   http.MethodGet,
+			path:     "/api",
+			wantCode: http.StatusOK,
+			wantResp: "ra!",
+		},
+		{
+			name:     "route on group prefix",
+			method:   http.MethodGet,
+			path:     "/api/v2",
+			wantCode: http.StatusOK,
+			wantResp: "ra2!",
+		},
+		{
+			name:     "group route",
+			method:   http.MethodPost,
+			path:     "/api/login",
+			wantCode: http.StatusOK,
+			wantResp: "a!",
+		},
+		{
+			name:     "nested group with route middleware",
+			method:   http.MethodGet,
+			path:     "/api/v1/users/123",
+			wantCode: http.StatusOK,
+			wantResp: "ravu!",
+		},
+		{
+			name:     "nested group",
+			method:   http.MethodPost,
+			path:     "/api/v1/users",
+			wantCode: http.StatusOK,
+			wantResp: "av!",
+		},
+		{
+			name:     "root group",
+			method:   http.MethodGet,
+			path:     "/home",
+			wantCode: http.StatusOK,
+			wantResp: "r!",
+		},
+		{
+			name:     "not in group",
+			method:   http.MethodGet,
+			path:     "/other",
+			wantCode: http.StatusOK,
+			wantResp: "r!",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantResp, recorder.Body.String())
+		})
+	}
+
+	// 分组的 middleware 不会影响没有注册过路由的方法
+	_, ok := s.trees[http.MethodDelete]
+	assert.False(t, ok)
+
+	assert.PanicsWithValue(t, "kyuu: 分组前缀必须以 / 开头 [api]", func() {
+		s.Group("api")
+	})
+	assert.PanicsWithValue(t, "kyuu: 分组前缀不能以 / 结尾 [/api/]", func() {
+		s.Group("/api/")
+	})
+	assert.PanicsWithValue(t, "kyuu: 路由必须以 / 开头", func() {
+		api.Get("user", handler)
+	})
+	assert.PanicsWithValue(t, "kyuu: 路由冲突[/api/login]", func() {
+		api.Post("/login", handler)
+	})
+}
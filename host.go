@@ -0,0 +1,201 @@
+package kyuu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hostRouter 某个域名下的路由树，以及这个域名的 middleware
+type hostRouter struct {
+	pattern hostPattern
+	router
+	mdls []Middleware
+	// 组装好了域名 middleware 的入口
+	handler HandleFunc
+}
+
+// Host 按照域名注册路由，返回的分组上注册的路由只对这个域名生效
+// pattern 支持三种形式：
+//   - 精确的域名，例如 api.example.com
+//   - 通配符，例如 *.example.com，* 只能出现在最左边，可以匹配一段或者多段，例如 a.example.com 和 a.b.example.com
+//   - 参数，例如 :tenant.example.com，参数只能匹配一段，它的值会放进 PathParams，
+//     和路径参数同名的时候以路径参数为准
+//
+// 优先级是 精确 > 参数 > 通配符，同一种形式下段数多的优先
+// 命中了某个域名的请求只会在这个域名的路由树里面查找，没有命中任何域名的请求使用默认的路由树
+// 匹配的时候忽略端口和大小写
+//
+// mdls 是这个域名的 middleware，在全局 middleware 之后、路由匹配之前执行，
+// 所以即便是 404 也会经过它们。同一个 pattern 多次调用 Host 的时候，middleware 会追加在后面
+//
+//	tenant := s.Host(":tenant.example.com", loadTenant)
+//	tenant.Get("/dashboard", func(ctx *kyuu.Context) {
+//		name, _ := ctx.PathValue("tenant").String()
+//	})
+func (s *HTTPServer) Host(pattern string, mdls ...Middleware) *RouteGroup {
+	hp := parseHostPattern(pattern)
+	h, ok := s.findHost(hp.pattern)
+	if !ok {
+		h = &hostRouter{pattern: hp, router: newRouter()}
+		// 命名路由在整个 HTTPServer 内都不能重复，并且都可以用 URLFor 生成
+		h.names = s.names
+		h.caseInsensitive = s.caseInsensitive
+		if hp.exact {
+			if s.hosts == nil {
+				s.hosts = map[string]*hostRouter{}
+			}
+			s.hosts[hp.pattern] = h
+		} else {
+			s.hostPatterns = append(s.hostPatterns, h)
+			sort.SliceStable(s.hostPatterns, func(i, j int) bool {
+				return s.hostPatterns[i].pattern.before(s.hostPatterns[j].pattern)
+			})
+		}
+	}
+	h.mdls = append(h.mdls, mdls...)
+	h.buildHandler(s)
+	return newRouteGroup(&h.router, nil, "/", nil)
+}
+
+func (s *HTTPServer) findHost(pattern string) (*hostRouter, bool) {
+	if h, ok := s.hosts[pattern]; ok {
+		return h, true
+	}
+	for _, h := range s.hostPatterns {
+		if h.pattern.pattern == pattern {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func (h *hostRouter) buildHandler(s *HTTPServer) {
+	root := func(ctx *Context) {
+		s.serveRouter(ctx, &h.router)
+	}
+	for i := len(h.mdls) - 1; i >= 0; i-- {
+		root = h.mdls[i](abortable(root))
+	}
+	h.handler = root
+}
+
+// matchHost 查找 host 对应的路由树，参数的值写入 mi
+func (s *HTTPServer) matchHost(host string, mi *matchInfo) (*hostRouter, bool) {
+	host = normalizeHost(host)
+	if h, ok := s.hosts[host]; ok {
+		return h, true
+	}
+	for _, h := range s.hostPatterns {
+		if h.pattern.match(host, nil) {
+			h.pattern.match(host, mi)
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeHost 去掉端口和结尾的 .，并且转为小写
+func normalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		// IPv6 [::1]:8080
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			host = host[:i+1]
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	host = strings.TrimSuffix(host, ".")
+	// 没有大写字母的时候 ToLower 不会分配内存
+	return strings.ToLower(host)
+}
+
+// hostPattern 解析之后的域名规则
+type hostPattern struct {
+	pattern string
+	// 按照 . 切分之后的每一段
+	labels []string
+	// 没有参数和通配符
+	exact bool
+	// 最左边是 *
+	wildcard bool
+	// 参数的个数
+	params int
+}
+
+func parseHostPattern(pattern string) hostPattern {
+	pattern = strings.ToLower(pattern)
+	if pattern == "" {
+		panic("kyuu: 域名不能为空字符串")
+	}
+	hp := hostPattern{pattern: pattern, labels: strings.Split(pattern, ".")}
+	for i, label := range hp.labels {
+		switch {
+		case label == "":
+			panic(fmt.Sprintf("kyuu: 非法的域名 [%s]，不允许出现空的一段", pattern))
+		case label == "*":
+			if i != 0 {
+				panic(fmt.Sprintf("kyuu: 非法的域名 [%s]，通配符 * 只能出现在最左边", pattern))
+			}
+			hp.wildcard = true
+		case label[0] == ':' && !strings.ContainsAny(label[1:], "*:/[]"):
+			if len(label) == 1 {
+				panic(fmt.Sprintf("kyuu: 非法的域名 [%s]，参数必须有名字", pattern))
+			}
+			hp.params++
+		case strings.ContainsAny(label, "*:/[]"):
+			panic(fmt.Sprintf("kyuu: 非法的域名 [%s]，不能带端口或者路径", pattern))
+		}
+	}
+	if hp.wildcard && len(hp.labels) == 1 {
+		panic(fmt.Sprintf("kyuu: 非法的域名 [%s]，不允许只有通配符", pattern))
+	}
+	hp.exact = !hp.wildcard && hp.params == 0
+	return hp
+}
+
+// before 匹配的时候 p 是否应该排在 other 前面
+// 参数优先于通配符，段数多的优先，参数少的优先
+func (p hostPattern) before(other hostPattern) bool {
+	if p.wildcard != other.wildcard {
+		return !p.wildcard
+	}
+	if len(p.labels) != len(other.labels) {
+		return len(p.labels) > len(other.labels)
+	}
+	return p.params < other.params
+}
+
+// match 从右往左逐段匹配 host，mi 不为 nil 的时候记录参数的值
+// 先用 nil 确认能够匹配上，再记录参数，避免匹配失败的规则留下参数
+func (p hostPattern) match(host string, mi *matchInfo) bool {
+	for i := len(p.labels) - 1; i >= 0; i-- {
+		label := p.labels[i]
+		if label == "*" {
+			// 至少要有一段
+			return host != ""
+		}
+		var seg string
+		if idx := strings.LastIndexByte(host, '.'); idx >= 0 {
+			seg, host = host[idx+1:], host[:idx]
+		} else {
+			seg, host = host, ""
+			if i > 0 {
+				return false
+			}
+		}
+		if seg == "" {
+			return false
+		}
+		if label[0] == ':' {
+			if mi != nil {
+				mi.addHostValue(label[1:], seg)
+			}
+			continue
+		}
+		if label != seg {
+			return false
+		}
+	}
+	return host == ""
+}
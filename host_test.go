@@ -0,0 +1,197 @@
+package kyuu
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServer_Host(t *testing.T) {
+	s := NewHTTPServer()
+	resp := func(name string) HandleFunc {
+		return func(ctx *Context) {
+			ctx.RespString(http.StatusOK, name+" "+ctx.PathParams["tenant"]+" "+ctx.PathParams["id"])
+		}
+	}
+	mark := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				next(ctx)
+				ctx.RespData = append(ctx.RespData, name...)
+			}
+		}
+	}
+	s.Get("/", resp("default"))
+	s.Get("/user/:id", resp("default"))
+
+	api := s.Host("api.example.com", mark("!api"))
+	api.Get("/", resp("api"))
+	api.Group("/v1").Get("/user/:id", resp("api"))
+
+	tenant := s.Host(":tenant.example.com", mark("!tenant"))
+	tenant.Get("/user/:id", resp("tenant"))
+	tenant.Post("/user/:id", resp("tenant"))
+
+	s.Host("*.example.com").Get("/", resp("wildcard"))
+	// 同一个域名再次注册，middleware 追加在后面
+	s.Host("API.example.com", mark("!again"))
+
+	testCases := []struct {
+		name     string
+		method   string
+		host     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "default",
+			method:   http.MethodGet,
+			host:     "localhost:8080",
+			path:     "/user/1",
+			wantCode: http.StatusOK,
+			wantBody: "default  1",
+		},
+		{
+			name:     "exact",
+			method:   http.MethodGet,
+			host:     "api.example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "api  !again!api",
+		},
+		{
+			name:     "exact with port and upper case",
+			method:   http.MethodGet,
+			host:     "API.Example.com:8080",
+			path:     "/v1/user/2",
+			wantCode: http.StatusOK,
+			wantBody: "api  2!again!api",
+		},
+		{
+			// 命中了域名就不会再回到默认的路由树
+			name:     "exact not found",
+			method:   http.MethodGet,
+			host:     "api.example.com",
+			path:     "/user/1",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found!again!api",
+		},
+		{
+			name:     "param",
+			method:   http.MethodGet,
+			host:     "acme.example.com",
+			path:     "/user/3",
+			wantCode: http.StatusOK,
+			wantBody: "tenant acme 3!tenant",
+		},
+		{
+			name:     "param method not allowed",
+			method:   http.MethodDelete,
+			host:     "acme.example.com",
+			path:     "/user/3",
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: "Method Not Allowed!tenant",
+		},
+		{
+			name:     "param before wildcard",
+			method:   http.MethodGet,
+			host:     "acme.example.com",
+			path:     "/",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found!tenant",
+		},
+		{
+			name:     "wildcard",
+			method:   http.MethodGet,
+			host:     "a.b.example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "wildcard  ",
+		},
+		{
+			name:     "no subdomain",
+			method:   http.MethodGet,
+			host:     "example.com",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "default  ",
+		},
+		{
+			name:     "other domain",
+			method:   http.MethodGet,
+			host:     "acme.example.org",
+			path:     "/user/4",
+			wantCode: http.StatusOK,
+			wantBody: "default  4",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://"+tc.host+tc.path, nil)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPServer_HostParamInMiddleware(t *testing.T) {
+	s := NewHTTPServer()
+	var tenant string
+	s.Host(":tenant.example.com", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			tenant, _ = ctx.PathValue("tenant").String()
+			next(ctx)
+		}
+	}).Get("/user/:tenant", func(ctx *Context) {
+		// 同名的时候以路径参数为准
+		ctx.RespString(http.StatusOK, ctx.PathParams["tenant"])
+	})
+
+	for i := 0; i < 2; i++ {
+		// 第二次会复用 Context，结果不能受到上一次的影响
+		req := httptest.NewRequest(http.MethodGet, "http://acme.example.com/user/tom", nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		assert.Equal(t, "acme", tenant)
+		assert.Equal(t, "tom", recorder.Body.String())
+	}
+}
+
+func Test_parseHostPattern(t *testing.T) {
+	testCases := []struct {
+		pattern   string
+		wantPanic bool
+		host      string
+		wantMatch bool
+	}{
+		{pattern: "example.com", host: "example.com", wantMatch: true},
+		{pattern: "*.example.com", host: "example.com"},
+		{pattern: "*.example.com", host: "a.example.com", wantMatch: true},
+		{pattern: ":t.example.com", host: "a.b.example.com"},
+		{pattern: ":t.:r.example.com", host: "a.b.example.com", wantMatch: true},
+		{pattern: ":t.example.com", host: "aexample.com"},
+		{pattern: "", wantPanic: true},
+		{pattern: "a..com", wantPanic: true},
+		{pattern: "a.*.com", wantPanic: true},
+		{pattern: "*", wantPanic: true},
+		{pattern: ":.example.com", wantPanic: true},
+		{pattern: "example.com:8080", wantPanic: true},
+		{pattern: "example.com/a", wantPanic: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			if tc.wantPanic {
+				assert.Panics(t, func() {
+					parseHostPattern(tc.pattern)
+				})
+				return
+			}
+			hp := parseHostPattern(tc.pattern)
+			assert.Equal(t, tc.wantMatch, hp.match(tc.host, nil))
+		})
+	}
+}
@@ -1,3 +1,49 @@
 package kyuu
 
 type Middleware func(next HandleFunc) HandleFunc
+
+// abortable 前面的 middleware 调用了 Abort 之后，next 不再执行
+// 组装 middleware 的时候包在每一个 next 外面，这样 middleware 自己不需要判断 IsAborted
+func abortable(next HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		if ctx.aborted {
+			return
+		}
+		next(ctx)
+	}
+}
+
+// Skip predicate 返回 true 的时候跳过 mdl，直接执行 next
+//
+//	s.Use(kyuu.Skip(func(ctx *kyuu.Context) bool {
+//		return ctx.Req.URL.Path == "/health"
+//	}, accesslog.NewBuilder().Build()))
+func Skip(predicate func(ctx *Context) bool, mdl Middleware) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		wrapped := mdl(next)
+		return func(ctx *Context) {
+			if predicate(ctx) {
+				next(ctx)
+				return
+			}
+			wrapped(ctx)
+		}
+	}
+}
+
+// OnlyRoutes mdl 只对 routes 生效，routes 的写法和注册路由一样，例如 /user/:id、/admin/*
+// 它是用请求的路径去匹配 routes，而不是 MatchedRoute，所以作为全局 middleware 使用也没有问题
+// routes 不区分 HTTP 方法
+func OnlyRoutes(routes []string, mdl Middleware) Middleware {
+	r := newRouter()
+	for _, route := range routes {
+		r.addRoute(anyMethod, route, func(ctx *Context) {})
+	}
+	return Skip(func(ctx *Context) bool {
+		var mi matchInfo
+		return !r.match(anyMethod, ctx.Req.URL.Path, &mi) || mi.n.handler == nil
+	}, mdl)
+}
+
+// OnlyRoutes 用的路由树不区分 HTTP 方法，所有的路由都注册在这个方法下面
+const anyMethod = "*"
@@ -3,6 +3,7 @@ package accesslog
 import (
 	"encoding/json"
 	"github.com/coderi421/kyuu"
+	"github.com/coderi421/kyuu/middleware/requestid"
 )
 
 type MiddlewareBuilder struct {
@@ -29,6 +30,8 @@ func (m *MiddlewareBuilder) Build() kyuu.Middleware {
 					Route:      ctx.MatchedRoute,
 					HTTPMethod: ctx.Req.Method,
 					Path:       ctx.Req.URL.Path,
+					// 注册了 requestid 的时候才有值
+					RequestID: requestid.Get(ctx),
 				}
 
 				data, _ := json.Marshal(l)
@@ -47,4 +50,5 @@ type accessLog struct {
 	Route      string `json:"route,omitempty"` // 命中路由
 	HTTPMethod string `json:"http_method,omitempty"`
 	Path       string `json:"path,omitempty"` // 访问的路径
+	RequestID  string `json:"request_id,omitempty"`
 }
@@ -3,7 +3,10 @@ package accesslog
 import (
 	"fmt"
 	"github.com/coderi421/kyuu"
+	"github.com/coderi421/kyuu/middleware/requestid"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -24,3 +27,17 @@ func TestMiddlewareBuilder(t *testing.T) {
 	}
 	server.ServeHTTP(nil, req)
 }
+
+func TestMiddlewareBuilder_requestID(t *testing.T) {
+	var log string
+	server := kyuu.NewHTTPServer()
+	// accesslog 在外层也能拿到请求 ID
+	server.Use(NewBuilder().LogFunc(func(l string) {
+		log = l
+	}).Build(), requestid.NewBuilder().Build())
+	server.Get("/user", func(ctx *kyuu.Context) {})
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(requestid.HeaderName, "abc-123")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, `{"host":"example.com","route":"/user","http_method":"GET","path":"/user","request_id":"abc-123"}`, log)
+}
@@ -0,0 +1,299 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"github.com/coderi421/kyuu"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// MiddlewareBuilder 根据 Accept-Encoding 使用 gzip 或者 deflate 压缩响应
+// 压缩的是 RespData 和 Context.Stream 写入的数据，直接写入 Resp 的响应，例如 RespFile 和静态资源，不会被压缩
+// 已经设置了 Content-Encoding 的响应也不会被压缩
+// 在它外层的 middleware 看到的 RespData 是压缩之后的数据，所以需要读取响应体的 middleware 应该注册在它后面
+type MiddlewareBuilder struct {
+	minLength    int
+	level        int
+	contentTypes []string
+}
+
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		minLength: 1024,
+		level:     gzip.DefaultCompression,
+		contentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"image/svg+xml",
+		},
+	}
+}
+
+// MinLength RespData 小于这个长度的时候不压缩，默认是 1024
+// 流式响应不知道最终的长度，所以总是压缩
+func (m *MiddlewareBuilder) MinLength(length int) *MiddlewareBuilder {
+	m.minLength = length
+	return m
+}
+
+// Level 压缩级别，gzip 和 deflate 的级别是一样的，默认是 gzip.DefaultCompression
+func (m *MiddlewareBuilder) Level(level int) *MiddlewareBuilder {
+	m.level = level
+	return m
+}
+
+// ContentTypes 需要压缩的 Content-Type，会替换掉默认值
+// 可以用 text/* 这种形式匹配一类
+func (m *MiddlewareBuilder) ContentTypes(types ...string) *MiddlewareBuilder {
+	m.contentTypes = types
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	if _, err := gzip.NewWriterLevel(io.Discard, m.level); err != nil {
+		panic("compress: " + err.Error())
+	}
+	// 创建 gzip.Writer 和 flate.Writer 的开销很大，所以复用它们
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, m.level)
+			return w
+		}},
+		encodingDeflate: {New: func() any {
+			w, _ := flate.NewWriter(io.Discard, m.level)
+			return w
+		}},
+	}
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			encoding := negotiate(ctx.Req.Header.Get("Accept-Encoding"))
+			resp := ctx.Resp
+			cw := &compressWriter{ResponseWriter: resp, ctx: ctx, m: m, encoding: encoding, pool: pools[encoding]}
+			ctx.Resp = cw
+			// 底层不支持 Flush 的时候，ctx.Stream 要能够判断出来
+			if _, ok := resp.(http.Flusher); ok {
+				ctx.Resp = flushWriter{compressWriter: cw}
+			}
+			defer func() {
+				ctx.Resp = resp
+				cw.close()
+			}()
+
+			next(ctx)
+
+			if cw.wroteHeader || ctx.IsStreaming() {
+				// 直接写入 Resp 的响应，是否压缩在写入的时候已经决定了
+				return
+			}
+			if !m.compressible(resp.Header(), ctx.RespStatusCode, ctx.RespData) {
+				return
+			}
+			addVary(resp.Header())
+			if encoding == "" || len(ctx.RespData) < m.minLength {
+				return
+			}
+			var buf bytes.Buffer
+			pool := pools[encoding]
+			c := pool.Get().(compressor)
+			defer func() {
+				c.Reset(io.Discard)
+				pool.Put(c)
+			}()
+			c.Reset(&buf)
+			if _, err := c.Write(ctx.RespData); err != nil {
+				return
+			}
+			if err := c.Close(); err != nil {
+				return
+			}
+			resp.Header().Set("Content-Encoding", encoding)
+			resp.Header().Del("Content-Length")
+			ctx.RespData = buf.Bytes()
+		}
+	}
+}
+
+// compressible 判断响应是否需要压缩，不考虑长度和 Accept-Encoding
+func (m *MiddlewareBuilder) compressible(header http.Header, code int, data []byte) bool {
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if code < http.StatusOK || code == http.StatusNoContent ||
+		code == http.StatusPartialContent || code == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		// 已经压缩过了
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		if len(data) == 0 {
+			return false
+		}
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range m.contentTypes {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(header http.Header) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// negotiate 根据 Accept-Encoding 选择 gzip 或者 deflate，q 值相同的时候优先使用 gzip
+// 都不接受的时候返回空字符串
+func negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	// -1 代表没有出现
+	gzipQ, deflateQ, anyQ := -1.0, -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if params != "" {
+			key, val, _ := strings.Cut(strings.TrimSpace(params), "=")
+			if strings.TrimSpace(key) == "q" {
+				f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case encodingGzip, "x-gzip":
+			gzipQ = q
+		case encodingDeflate:
+			deflateQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	// 没有明确出现的编码使用 * 的 q 值
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	if deflateQ < 0 {
+		deflateQ = anyQ
+	}
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return encodingGzip
+	case deflateQ > 0:
+		return encodingDeflate
+	}
+	return ""
+}
+
+// compressor gzip.Writer 和 flate.Writer 共同的方法
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter 压缩流式响应，其它直接写入的响应原样写入
+type compressWriter struct {
+	http.ResponseWriter
+	ctx      *kyuu.Context
+	m        *MiddlewareBuilder
+	encoding string
+	pool     *sync.Pool
+	// 正在使用的 compressor，为 nil 的时候不压缩
+	c           compressor
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.ResponseWriter.Header()
+	// 只有流式响应需要压缩，这个时候还没有数据，所以不能根据数据推断 Content-Type
+	if w.ctx.IsStreaming() && header.Get("Content-Type") != "" && w.m.compressible(header, code, nil) {
+		addVary(header)
+		if w.encoding != "" {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			w.c = w.pool.Get().(compressor)
+			w.c.Reset(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.c != nil {
+		return w.c.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// flushWriter 底层的 ResponseWriter 支持 Flush 的时候使用
+type flushWriter struct {
+	*compressWriter
+}
+
+// Flush 先把压缩的数据刷到底层的 ResponseWriter，再发送给客户端
+func (w flushWriter) Flush() {
+	if w.c != nil {
+		_ = w.c.Flush()
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("compress: ResponseWriter 不支持 Hijack")
+	}
+	return hj.Hijack()
+}
+
+// close 写入压缩数据的结尾，并且回收 compressor
+func (w *compressWriter) close() {
+	if w.c == nil {
+		return
+	}
+	_ = w.c.Close()
+	w.c.Reset(io.Discard)
+	w.pool.Put(w.c)
+	w.c = nil
+}
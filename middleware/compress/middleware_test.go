@@ -0,0 +1,231 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/coderi421/kyuu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	large := strings.Repeat("kyuu ", 500)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte(large), 0o644))
+
+	s := kyuu.NewHTTPServer()
+	s.Use(NewBuilder().Build())
+	s.Get("/large", func(ctx *kyuu.Context) {
+		ctx.RespString(http.StatusOK, large)
+	})
+	s.Get("/small", func(ctx *kyuu.Context) {
+		ctx.RespString(http.StatusOK, "small")
+	})
+	s.Get("/json", func(ctx *kyuu.Context) {
+		_ = ctx.RespJSONOK([]string{large})
+	})
+	s.Get("/png", func(ctx *kyuu.Context) {
+		ctx.RespBytes(http.StatusOK, "image/png", []byte(large))
+	})
+	s.Get("/encoded", func(ctx *kyuu.Context) {
+		ctx.Resp.Header().Set("Content-Encoding", "br")
+		ctx.RespString(http.StatusOK, large)
+	})
+	s.Get("/no-content", func(ctx *kyuu.Context) {
+		ctx.RespStatusCode = http.StatusNoContent
+	})
+	s.Get("/file", func(ctx *kyuu.Context) {
+		_ = ctx.RespFile(filepath.Join(dir, "a.txt"))
+	})
+	s.Get("/stream", func(ctx *kyuu.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		sw, err := ctx.Stream(http.StatusOK)
+		require.NoError(t, err)
+		_, _ = sw.Write([]byte("hello "))
+		_ = sw.Flush()
+		_, _ = sw.Write([]byte("world"))
+	})
+
+	testCases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       bool
+		wantBody       string
+	}{
+		{
+			name:           "gzip",
+			path:           "/large",
+			acceptEncoding: "gzip, deflate, br",
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:           "deflate",
+			path:           "/large",
+			acceptEncoding: "gzip;q=0.5, deflate",
+			wantEncoding:   "deflate",
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:     "not accepted",
+			path:     "/large",
+			wantVary: true,
+			wantBody: large,
+		},
+		{
+			name:           "too small",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantVary:       true,
+			wantBody:       "small",
+		},
+		{
+			name:           "json",
+			path:           "/json",
+			acceptEncoding: "*",
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       `["` + large + `"]`,
+		},
+		{
+			name:           "content type",
+			path:           "/png",
+			acceptEncoding: "gzip",
+			wantBody:       large,
+		},
+		{
+			name:           "already encoded",
+			path:           "/encoded",
+			acceptEncoding: "gzip",
+			wantEncoding:   "br",
+			wantBody:       large,
+		},
+		{
+			name:           "no content",
+			path:           "/no-content",
+			acceptEncoding: "gzip",
+		},
+		{
+			name:           "file",
+			path:           "/file",
+			acceptEncoding: "gzip",
+			wantBody:       large,
+		},
+		{
+			name:           "stream",
+			path:           "/stream",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       "hello world",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantEncoding, recorder.Header().Get("Content-Encoding"))
+			if tc.wantVary {
+				assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, recorder.Header().Get("Vary"))
+			}
+			assert.Equal(t, tc.wantBody, decode(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, data []byte) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		r = gr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(data))
+	default:
+		return string(data)
+	}
+	res, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(res)
+}
+
+func TestMiddlewareBuilder_Build_flusher(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Use(NewBuilder().Build())
+	var streamErr error
+	s.Get("/stream", func(ctx *kyuu.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		_, streamErr = ctx.Stream(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name    string
+		resp    func() http.ResponseWriter
+		wantErr bool
+	}{
+		{
+			name: "flusher",
+			resp: func() http.ResponseWriter {
+				return httptest.NewRecorder()
+			},
+		},
+		{
+			// 底层不支持 Flush 的时候，压缩之后也不能支持
+			name: "not flusher",
+			resp: func() http.ResponseWriter {
+				return struct{ http.ResponseWriter }{httptest.NewRecorder()}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			streamErr = nil
+			req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			s.ServeHTTP(tc.resp(), req)
+			assert.Equal(t, tc.wantErr, streamErr != nil)
+		})
+	}
+}
+
+func Test_negotiate(t *testing.T) {
+	testCases := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "br, gzip", want: "gzip"},
+		{acceptEncoding: "deflate, gzip", want: "gzip"},
+		{acceptEncoding: "deflate", want: "deflate"},
+		{acceptEncoding: "gzip;q=0.8, deflate;q=0.9", want: "deflate"},
+		{acceptEncoding: "gzip;q=0, *", want: "deflate"},
+		{acceptEncoding: "*;q=0", want: ""},
+		{acceptEncoding: "GZIP", want: "gzip"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			assert.Equal(t, tc.want, negotiate(tc.acceptEncoding))
+		})
+	}
+}
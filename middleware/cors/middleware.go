@@ -0,0 +1,246 @@
+package cors
+
+import (
+	"github.com/coderi421/kyuu"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MiddlewareBuilder 跨域资源共享
+// 预检请求在这里直接响应，不会进入路由匹配，所以应该用 Use 注册为全局的 middleware
+//
+//	s.Use(cors.NewBuilder().
+//		AllowOrigins("https://app.example.com", "https://*.example.com").
+//		AllowCredentials(true).
+//		ExposeHeaders("X-Request-ID").
+//		MaxAge(time.Hour).
+//		Build())
+type MiddlewareBuilder struct {
+	allowOrigins     []string
+	allowOriginFunc  func(origin string) bool
+	allowMethods     []string
+	allowHeaders     []string
+	exposeHeaders    []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// NewBuilder 默认允许所有的来源，以及 GET、HEAD、POST、PUT、PATCH 和 DELETE
+// 没有设置 AllowHeaders 的时候，预检请求里面的 Access-Control-Request-Headers 都会被允许
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		allowOrigins: []string{"*"},
+		allowMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+	}
+}
+
+// AllowOrigins 允许的来源，会替换掉默认值
+// 支持精确的来源，例如 https://example.com，
+// 带一个通配符的来源，例如 https://*.example.com，以及允许所有来源的 *
+func (m *MiddlewareBuilder) AllowOrigins(origins ...string) *MiddlewareBuilder {
+	m.allowOrigins = origins
+	return m
+}
+
+// AllowOriginFunc 自定义的判断逻辑，AllowOrigins 不允许的来源再交给它判断
+// 只使用 AllowOriginFunc 的时候，需要先调用 AllowOrigins() 清空默认的 *
+func (m *MiddlewareBuilder) AllowOriginFunc(fn func(origin string) bool) *MiddlewareBuilder {
+	m.allowOriginFunc = fn
+	return m
+}
+
+// AllowMethods 允许的 HTTP 方法，会替换掉默认值
+func (m *MiddlewareBuilder) AllowMethods(methods ...string) *MiddlewareBuilder {
+	m.allowMethods = methods
+	return m
+}
+
+// AllowHeaders 允许的请求头
+func (m *MiddlewareBuilder) AllowHeaders(headers ...string) *MiddlewareBuilder {
+	m.allowHeaders = headers
+	return m
+}
+
+// ExposeHeaders 允许前端读取的响应头
+func (m *MiddlewareBuilder) ExposeHeaders(headers ...string) *MiddlewareBuilder {
+	m.exposeHeaders = headers
+	return m
+}
+
+// AllowCredentials 是否允许携带 cookie 之类的凭证
+// 允许的时候不能同时允许所有来源，否则任何网站都能带着用户的凭证访问，
+// 需要通过 AllowOrigins 或者 AllowOriginFunc 指定来源，否则 Build 的时候会 panic
+func (m *MiddlewareBuilder) AllowCredentials(allow bool) *MiddlewareBuilder {
+	m.allowCredentials = allow
+	return m
+}
+
+// MaxAge 预检请求的结果可以缓存多久，为 0 的时候不设置
+func (m *MiddlewareBuilder) MaxAge(maxAge time.Duration) *MiddlewareBuilder {
+	m.maxAge = maxAge
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	c := &corsConfig{
+		allowCredentials: m.allowCredentials,
+		allowOriginFunc:  m.allowOriginFunc,
+		allowMethods:     strings.Join(m.allowMethods, ", "),
+		allowHeaders:     strings.Join(m.allowHeaders, ", "),
+		exposeHeaders:    strings.Join(m.exposeHeaders, ", "),
+		methods:          map[string]bool{},
+		headers:          map[string]bool{},
+	}
+	if m.maxAge > 0 {
+		c.maxAge = strconv.Itoa(int(m.maxAge / time.Second))
+	}
+	for _, method := range m.allowMethods {
+		c.methods[strings.ToUpper(method)] = true
+	}
+	for _, h := range m.allowHeaders {
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, origin := range m.allowOrigins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, "*") {
+		case 0:
+			c.origins = append(c.origins, origin)
+		case 1:
+			if origin == "*" {
+				c.allowAll = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, wildcard{prefix: prefix, suffix: suffix})
+		default:
+			panic("cors: 来源只能包含一个通配符 * [" + origin + "]")
+		}
+	}
+	if c.allowAll && c.allowCredentials {
+		panic("cors: 允许携带凭证的时候不能允许所有的来源")
+	}
+
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			origin := ctx.Req.Header.Get("Origin")
+			if origin == "" {
+				// 不是跨域请求
+				next(ctx)
+				return
+			}
+			header := ctx.Resp.Header()
+			if ctx.Req.Method == http.MethodOptions && ctx.Req.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(ctx, origin, header)
+				// 预检请求不需要执行后面的逻辑
+				ctx.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			if !c.allowAll {
+				// 响应和 Origin 有关，缓存的时候要区分
+				header.Add("Vary", "Origin")
+			}
+			if c.allowOrigin(origin) {
+				c.setOrigin(header, origin)
+				if c.exposeHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+				}
+			}
+			next(ctx)
+		}
+	}
+}
+
+type wildcard struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcard) match(origin string) bool {
+	return len(origin) > len(w.prefix)+len(w.suffix) &&
+		strings.HasPrefix(origin, w.prefix) && strings.HasSuffix(origin, w.suffix)
+}
+
+// corsConfig Build 的时候预先处理好的配置
+type corsConfig struct {
+	allowAll         bool
+	origins          []string
+	wildcards        []wildcard
+	allowOriginFunc  func(origin string) bool
+	allowCredentials bool
+	// 预先拼接好的响应头
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+	methods       map[string]bool
+	headers       map[string]bool
+}
+
+func (c *corsConfig) allowOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	for _, o := range c.origins {
+		if o == lower {
+			return true
+		}
+	}
+	for _, w := range c.wildcards {
+		if w.match(lower) {
+			return true
+		}
+	}
+	return c.allowOriginFunc != nil && c.allowOriginFunc(origin)
+}
+
+func (c *corsConfig) setOrigin(header http.Header, origin string) {
+	if c.allowAll {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight 处理预检请求，不允许的时候不设置任何 CORS 响应头，浏览器会拒绝后续的请求
+func (c *corsConfig) preflight(ctx *kyuu.Context, origin string, header http.Header) {
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if !c.allowOrigin(origin) {
+		return
+	}
+	method := ctx.Req.Header.Get("Access-Control-Request-Method")
+	if !c.methods[strings.ToUpper(method)] {
+		return
+	}
+	reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers")
+	allowHeaders := c.allowHeaders
+	if len(c.headers) == 0 {
+		// 没有限制请求头，请求什么就允许什么
+		allowHeaders = reqHeaders
+	} else {
+		for _, h := range strings.Split(reqHeaders, ",") {
+			h = strings.TrimSpace(h)
+			if h != "" && !c.headers[http.CanonicalHeaderKey(h)] {
+				return
+			}
+		}
+	}
+	c.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if allowHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+	}
+	if c.maxAge != "" {
+		header.Set("Access-Control-Max-Age", c.maxAge)
+	}
+}
@@ -0,0 +1,203 @@
+package cors
+
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	newServer := func(b *MiddlewareBuilder) *kyuu.HTTPServer {
+		s := kyuu.NewHTTPServer()
+		s.Use(b.Build())
+		s.Post("/user", func(ctx *kyuu.Context) {
+			ctx.RespString(http.StatusOK, "ok")
+		})
+		return s
+	}
+	restricted := NewBuilder().
+		AllowOrigins("https://app.example.com", "https://*.example.org").
+		AllowOriginFunc(func(origin string) bool {
+			return strings.HasSuffix(origin, ".test")
+		}).
+		AllowMethods(http.MethodGet, http.MethodPost).
+		AllowHeaders("Content-Type", "X-Token").
+		ExposeHeaders("X-Request-ID").
+		AllowCredentials(true).
+		MaxAge(time.Hour)
+
+	testCases := []struct {
+		name       string
+		builder    *MiddlewareBuilder
+		method     string
+		header     map[string]string
+		wantCode   int
+		wantHeader map[string]string
+	}{
+		{
+			name:     "not cors",
+			builder:  restricted,
+			method:   http.MethodPost,
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "",
+			},
+		},
+		{
+			name:     "allow all",
+			builder:  NewBuilder(),
+			method:   http.MethodPost,
+			header:   map[string]string{"Origin": "https://foo.com"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "",
+			},
+		},
+		{
+			name:     "allow all preflight",
+			builder:  NewBuilder(),
+			method:   http.MethodOptions,
+			header:   map[string]string{"Origin": "https://foo.com", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "X-Any"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "X-Any",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			name:     "exact",
+			builder:  restricted,
+			method:   http.MethodPost,
+			header:   map[string]string{"Origin": "https://app.example.com"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:     "wildcard",
+			builder:  restricted,
+			method:   http.MethodPost,
+			header:   map[string]string{"Origin": "https://a.example.org"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://a.example.org",
+			},
+		},
+		{
+			name:     "predicate",
+			builder:  restricted,
+			method:   http.MethodPost,
+			header:   map[string]string{"Origin": "http://localhost.test"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "http://localhost.test",
+			},
+		},
+		{
+			// 业务逻辑依旧执行，由浏览器拒绝
+			name:     "origin not allowed",
+			builder:  restricted,
+			method:   http.MethodPost,
+			header:   map[string]string{"Origin": "https://example.org"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:     "preflight",
+			builder:  restricted,
+			method:   http.MethodOptions,
+			header:   map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type, x-token"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Token",
+				"Access-Control-Max-Age":           "3600",
+				"Access-Control-Expose-Headers":    "",
+			},
+		},
+		{
+			name:     "preflight method not allowed",
+			builder:  restricted,
+			method:   http.MethodOptions,
+			header:   map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:     "preflight header not allowed",
+			builder:  restricted,
+			method:   http.MethodOptions,
+			header:   map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "X-Other"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			// 没有 Access-Control-Request-Method 的 OPTIONS 请求不是预检请求，交给路由处理
+			name:     "options",
+			builder:  restricted,
+			method:   http.MethodOptions,
+			header:   map[string]string{"Origin": "https://app.example.com"},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin": "https://app.example.com",
+				"Allow":                       "OPTIONS, POST",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServer(tc.builder)
+			req := httptest.NewRequest(tc.method, "/user", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, recorder.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Build_invalidOrigin(t *testing.T) {
+	assert.Panics(t, func() {
+		NewBuilder().AllowOrigins("https://*.*.example.com").Build()
+	})
+}
+
+func TestMiddlewareBuilder_Build_allowAllWithCredentials(t *testing.T) {
+	assert.PanicsWithValue(t, "cors: 允许携带凭证的时候不能允许所有的来源", func() {
+		NewBuilder().AllowCredentials(true).Build()
+	})
+	assert.PanicsWithValue(t, "cors: 允许携带凭证的时候不能允许所有的来源", func() {
+		NewBuilder().AllowOrigins("https://app.example.com", "*").AllowCredentials(true).Build()
+	})
+	assert.NotPanics(t, func() {
+		NewBuilder().AllowOrigins("https://app.example.com").AllowCredentials(true).Build()
+	})
+}
@@ -0,0 +1,172 @@
+package loadshed
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter 并发限制，超过上限的请求在队列里面排队，按照先来后到的顺序放行
+type limiter struct {
+	mutex     sync.Mutex
+	limit     int
+	inflight  int
+	queueSize int
+	waiters   []chan struct{}
+	rejected  uint64
+	// 为 nil 的时候上限是固定的
+	adaptive *gradient
+}
+
+func newLimiter(limit, queueSize int, adaptive *gradient) *limiter {
+	return &limiter{
+		limit:     limit,
+		queueSize: queueSize,
+		adaptive:  adaptive,
+	}
+}
+
+// acquire 获取一个并发额度，最多排队 maxWait，返回 false 的时候请求应该被拒绝
+func (l *limiter) acquire(ctx context.Context, maxWait time.Duration) bool {
+	l.mutex.Lock()
+	// 有请求在排队的时候，新来的请求也要排队，不能插队
+	if l.inflight < l.limit && len(l.waiters) == 0 {
+		l.inflight++
+		l.mutex.Unlock()
+		return true
+	}
+	if maxWait <= 0 || len(l.waiters) >= l.queueSize {
+		l.rejected++
+		l.mutex.Unlock()
+		return false
+	}
+	// 带缓冲，release 的时候不会阻塞
+	ch := make(chan struct{}, 1)
+	l.waiters = append(l.waiters, ch)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, w := range l.waiters {
+		if w == ch {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.rejected++
+			return false
+		}
+	}
+	// 超时的同时拿到了额度
+	return true
+}
+
+// release 归还额度，rtt 是请求的处理时间，用来调整自适应的上限
+func (l *limiter) release(rtt time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.adaptive != nil {
+		l.limit = l.adaptive.update(l.limit, l.inflight, rtt)
+	}
+	l.inflight--
+	// 上限变小的时候，等到 inflight 降下来之后才会放行排队的请求
+	for l.inflight < l.limit && len(l.waiters) > 0 {
+		ch := l.waiters[0]
+		l.waiters[0] = nil
+		l.waiters = l.waiters[1:]
+		l.inflight++
+		ch <- struct{}{}
+	}
+}
+
+// stats 限流器当前的状态，用于暴露监控指标
+type stats struct {
+	// limit 当前的并发上限，自适应模式下会变化
+	limit    int
+	inflight int
+	queued   int
+	// rejected 累计被拒绝的请求数量
+	rejected uint64
+}
+
+func (l *limiter) stats() stats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return stats{
+		limit:    l.limit,
+		inflight: l.inflight,
+		queued:   len(l.waiters),
+		rejected: l.rejected,
+	}
+}
+
+// gradient 根据延迟的变化调整并发上限，参考的是 Netflix concurrency-limits 里面的 Gradient2
+// 短期平均延迟比长期平均延迟高的时候，说明请求开始排队，减小上限；
+// 延迟平稳的时候，每次增加 sqrt(limit)，逐步探测系统的容量
+type gradient struct {
+	minLimit int
+	maxLimit int
+	// 每 window 个请求调整一次
+	window int
+
+	count       int
+	sum         time.Duration
+	maxInflight int
+	// 长期平均延迟，单位是纳秒
+	longRTT float64
+}
+
+const (
+	// longRTT 的指数移动平均系数，大约是最近 10 个窗口的平均值
+	longRTTFactor = 0.1
+	// 新上限的平滑系数，避免上限剧烈抖动
+	smoothing = 0.2
+)
+
+func (g *gradient) update(limit, inflight int, rtt time.Duration) int {
+	g.count++
+	g.sum += rtt
+	if inflight > g.maxInflight {
+		g.maxInflight = inflight
+	}
+	if g.count < g.window {
+		return limit
+	}
+	shortRTT := float64(g.sum) / float64(g.count)
+	maxInflight := g.maxInflight
+	g.count, g.sum, g.maxInflight = 0, 0, 0
+	if shortRTT <= 0 {
+		return limit
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = shortRTT
+	} else {
+		g.longRTT = g.longRTT*(1-longRTTFactor) + shortRTT*longRTTFactor
+	}
+	// 延迟恢复之后，长期平均延迟快速向短期平均延迟靠拢，否则上限会一直偏大
+	if g.longRTT/shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+	ratio := math.Max(0.5, math.Min(1, g.longRTT/shortRTT))
+	newLimit := float64(limit)*ratio + math.Sqrt(float64(limit))
+	newLimit = float64(limit)*(1-smoothing) + newLimit*smoothing
+	// 平滑之后的变化可能不到 1，取整的时候要朝着变化的方向，否则上限会一直不变
+	if newLimit > float64(limit) {
+		// 请求量不大的时候，延迟不能反映系统的容量，不增加上限
+		if maxInflight < limit/2 {
+			return limit
+		}
+		newLimit = math.Ceil(newLimit)
+	} else {
+		newLimit = math.Floor(newLimit)
+	}
+	return int(math.Max(float64(g.minLimit), math.Min(float64(g.maxLimit), newLimit)))
+}
@@ -0,0 +1,76 @@
+package loadshed
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(1, 1, nil)
+	assert.True(t, l.acquire(ctx, 0))
+	// 不排队的时候直接拒绝
+	assert.False(t, l.acquire(ctx, 0))
+
+	done := make(chan bool)
+	go func() {
+		done <- l.acquire(ctx, time.Second)
+	}()
+	assert.Eventually(t, func() bool {
+		return l.stats().queued == 1
+	}, time.Second, time.Millisecond)
+	// 队列已经满了
+	assert.False(t, l.acquire(ctx, time.Second))
+
+	// 归还的额度交给排队的请求
+	l.release(time.Millisecond)
+	assert.True(t, <-done)
+	assert.Equal(t, stats{limit: 1, inflight: 1, rejected: 2}, l.stats())
+
+	// 等待超时
+	assert.False(t, l.acquire(ctx, time.Millisecond*10))
+	// 客户端断开
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, l.acquire(cancelCtx, time.Second))
+	assert.Equal(t, stats{limit: 1, inflight: 1, rejected: 4}, l.stats())
+
+	l.release(time.Millisecond)
+	assert.True(t, l.acquire(ctx, 0))
+}
+
+func TestGradient_update(t *testing.T) {
+	g := &gradient{minLimit: 5, maxLimit: 20, window: 2}
+	limit := 10
+	feed := func(inflight int, rtt time.Duration) {
+		for i := 0; i < g.window; i++ {
+			limit = g.update(limit, inflight, rtt)
+		}
+	}
+
+	// 延迟平稳并且请求量足够，逐步增加
+	feed(10, time.Millisecond*10)
+	assert.Equal(t, 11, limit)
+	feed(11, time.Millisecond*10)
+	assert.Equal(t, 12, limit)
+
+	// 请求量不大的时候不增加
+	feed(2, time.Millisecond*10)
+	assert.Equal(t, 12, limit)
+
+	// 延迟变高，逐步减小上限，但是不会低于 minLimit
+	for i := 0; i < 7; i++ {
+		prev := limit
+		feed(limit, time.Millisecond*100)
+		assert.Less(t, limit, prev)
+	}
+	assert.Equal(t, 5, limit)
+
+	// 延迟恢复之后逐步增加，但是不会超过 maxLimit
+	for i := 0; i < 50; i++ {
+		feed(limit, time.Millisecond*10)
+	}
+	assert.Equal(t, 20, limit)
+}
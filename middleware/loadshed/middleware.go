@@ -0,0 +1,214 @@
+package loadshed
+
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MiddlewareBuilder 限制同时处理的请求数量，超过上限的请求排队等待，等不到的响应 503
+// 用 Use 注册的时候是全局的上限，注册在路由或者分组上的时候是这些路由共享的上限，
+// 调用 PerRoute 之后每个路由各自计算
+//
+//	s.Use(loadshed.NewBuilder(100).
+//		Queue(50, time.Millisecond*200).
+//		Adaptive(20, 500).
+//		Metrics("kyuu", "http", "global").
+//		Build())
+type MiddlewareBuilder struct {
+	limit     int
+	queueSize int
+	maxWait   time.Duration
+	perRoute  bool
+	data      []byte
+
+	adaptive bool
+	minLimit int
+	maxLimit int
+	window   int
+
+	metrics   bool
+	namespace string
+	subsystem string
+	name      string
+}
+
+// NewBuilder limit 是并发上限，默认不排队，超过上限直接拒绝
+func NewBuilder(limit int) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limit:  limit,
+		data:   []byte(http.StatusText(http.StatusServiceUnavailable)),
+		window: 100,
+	}
+}
+
+// Queue 超过上限的时候最多 size 个请求排队，每个请求最多等待 maxWait
+// 队列满了，或者等待超时的请求会被拒绝
+func (m *MiddlewareBuilder) Queue(size int, maxWait time.Duration) *MiddlewareBuilder {
+	m.queueSize = size
+	m.maxWait = maxWait
+	return m
+}
+
+// PerRoute 每个路由（方法加上路由）有各自的上限
+// MatchedRoute 在路由匹配之后才有值，所以只能注册在路由或者分组上
+func (m *MiddlewareBuilder) PerRoute() *MiddlewareBuilder {
+	m.perRoute = true
+	return m
+}
+
+// Data 被拒绝时的响应数据
+func (m *MiddlewareBuilder) Data(data []byte) *MiddlewareBuilder {
+	m.data = data
+	return m
+}
+
+// Adaptive 根据延迟自动调整上限，上限在 [minLimit, maxLimit] 之间，NewBuilder 的 limit 是初始值，
+// 它也必须在这个范围之内
+// 延迟变高的时候减小上限，延迟平稳的时候逐步增加
+func (m *MiddlewareBuilder) Adaptive(minLimit, maxLimit int) *MiddlewareBuilder {
+	m.adaptive = true
+	m.minLimit = minLimit
+	m.maxLimit = maxLimit
+	return m
+}
+
+// Metrics 将当前的上限、处理中和排队的请求数量以及拒绝的次数注册到 prometheus
+// name 用来区分多个限流的 middleware，会作为 limiter 标签的值
+func (m *MiddlewareBuilder) Metrics(namespace, subsystem, name string) *MiddlewareBuilder {
+	m.metrics = true
+	m.namespace = namespace
+	m.subsystem = subsystem
+	m.name = name
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	if m.limit <= 0 {
+		panic("loadshed: 并发上限必须大于 0")
+	}
+	if m.queueSize < 0 {
+		panic("loadshed: 队列的长度不能小于 0")
+	}
+	if m.adaptive && (m.minLimit <= 0 || m.minLimit > m.maxLimit) {
+		panic("loadshed: 自适应上限的范围不合法")
+	}
+	if m.adaptive && (m.limit < m.minLimit || m.limit > m.maxLimit) {
+		panic("loadshed: 初始的并发上限必须在自适应上限的范围之内")
+	}
+	g := &limiterGroup{
+		perRoute: m.perRoute,
+		limiters: map[string]*limiter{},
+		newLimiter: func() *limiter {
+			var adaptive *gradient
+			if m.adaptive {
+				adaptive = &gradient{minLimit: m.minLimit, maxLimit: m.maxLimit, window: m.window}
+			}
+			return newLimiter(m.limit, m.queueSize, adaptive)
+		},
+	}
+	if m.metrics {
+		prometheus.MustRegister(newCollector(g, m.namespace, m.subsystem, m.name))
+	}
+	maxWait, data := m.maxWait, m.data
+
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			l := g.get(ctx)
+			if !l.acquire(ctx.Req.Context(), maxWait) {
+				ctx.AbortWithStatus(http.StatusServiceUnavailable)
+				ctx.RespData = data
+				return
+			}
+			start := time.Now()
+			// panic 的时候也要归还额度
+			defer func() {
+				l.release(time.Since(start))
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// limiterGroup 按照路由懒加载 limiter，不区分路由的时候只有一个
+type limiterGroup struct {
+	perRoute   bool
+	newLimiter func() *limiter
+	mutex      sync.RWMutex
+	limiters   map[string]*limiter
+}
+
+func (g *limiterGroup) get(ctx *kyuu.Context) *limiter {
+	key := ""
+	if g.perRoute {
+		key = ctx.Req.Method + " " + ctx.MatchedRoute
+	}
+	g.mutex.RLock()
+	l, ok := g.limiters[key]
+	g.mutex.RUnlock()
+	if ok {
+		return l
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	l, ok = g.limiters[key]
+	if !ok {
+		l = g.newLimiter()
+		g.limiters[key] = l
+	}
+	return l
+}
+
+func (g *limiterGroup) each(fn func(route string, l *limiter)) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	for route, l := range g.limiters {
+		fn(route, l)
+	}
+}
+
+// collector 在抓取的时候读取每个 limiter 的状态
+type collector struct {
+	group    *limiterGroup
+	limit    *prometheus.Desc
+	inflight *prometheus.Desc
+	queued   *prometheus.Desc
+	rejected *prometheus.Desc
+}
+
+func newCollector(g *limiterGroup, namespace, subsystem, name string) *collector {
+	// 不区分路由的时候 route 标签为空
+	labels := []string{"route"}
+	constLabels := prometheus.Labels{"limiter": name}
+	return &collector{
+		group: g,
+		limit: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "concurrency_limit"),
+			"当前的并发上限", labels, constLabels),
+		inflight: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "concurrency_inflight"),
+			"正在处理的请求数量", labels, constLabels),
+		queued: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "concurrency_queued"),
+			"正在排队的请求数量", labels, constLabels),
+		rejected: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "concurrency_rejected_total"),
+			"被拒绝的请求数量", labels, constLabels),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.limit
+	ch <- c.inflight
+	ch <- c.queued
+	ch <- c.rejected
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.group.each(func(route string, l *limiter) {
+		s := l.stats()
+		ch <- prometheus.MustNewConstMetric(c.limit, prometheus.GaugeValue, float64(s.limit), route)
+		ch <- prometheus.MustNewConstMetric(c.inflight, prometheus.GaugeValue, float64(s.inflight), route)
+		ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(s.queued), route)
+		ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(s.rejected), route)
+	})
+}
@@ -0,0 +1,111 @@
+package loadshed
+
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	block := make(chan struct{})
+	handler := func(ctx *kyuu.Context) {
+		<-block
+		ctx.RespString(http.StatusOK, "ok")
+	}
+	g := s.Group("/api", NewBuilder(1).PerRoute().Metrics("kyuu_test", "http", "api").Build())
+	g.Get("/user", handler)
+	g.Get("/order", handler)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, path := range []string{"/api/user", "/api/order"} {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			codes[i] = serve(path).Code
+		}(i, path)
+	}
+	assert.Eventually(t, func() bool {
+		return metricValue(t, "kyuu_test_http_concurrency_inflight") == 2
+	}, time.Second, time.Millisecond)
+
+	// 每个路由各自的上限
+	recorder := serve("/api/user")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "Service Unavailable", recorder.Body.String())
+
+	close(block)
+	wg.Wait()
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+	assert.Equal(t, http.StatusOK, serve("/api/user").Code)
+	assert.Equal(t, float64(1), metricValue(t, "kyuu_test_http_concurrency_rejected_total"))
+	assert.Equal(t, float64(2), metricValue(t, "kyuu_test_http_concurrency_limit"))
+}
+
+func TestMiddlewareBuilder_Build_queue(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Use(NewBuilder(1).Queue(10, time.Second).Build())
+	s.Get("/user", func(ctx *kyuu.Context) {
+		time.Sleep(time.Millisecond * 10)
+		ctx.RespString(http.StatusOK, "ok")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMiddlewareBuilder_Build_panic(t *testing.T) {
+	assert.Panics(t, func() {
+		NewBuilder(0).Build()
+	})
+	assert.Panics(t, func() {
+		NewBuilder(10).Adaptive(20, 10).Build()
+	})
+	assert.PanicsWithValue(t, "loadshed: 队列的长度不能小于 0", func() {
+		NewBuilder(10).Queue(-1, time.Second).Build()
+	})
+	assert.PanicsWithValue(t, "loadshed: 初始的并发上限必须在自适应上限的范围之内", func() {
+		NewBuilder(10).Adaptive(20, 500).Build()
+	})
+	assert.PanicsWithValue(t, "loadshed: 初始的并发上限必须在自适应上限的范围之内", func() {
+		NewBuilder(1000).Adaptive(20, 500).Build()
+	})
+}
+
+// metricValue 所有路由的指标加起来
+func metricValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	var sum float64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			sum += m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
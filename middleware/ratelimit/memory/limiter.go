@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/coderi421/kyuu/middleware/ratelimit"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	_ ratelimit.Limiter = (*TokenBucket)(nil)
+	_ ratelimit.Limiter = (*SlidingWindow)(nil)
+)
+
+// TokenBucket 令牌桶，桶里最多有 capacity 个令牌，每隔 interval 补满一次，也就是每 interval/capacity 补充一个
+// 允许瞬间的突发流量，长期来看速率不超过 capacity/interval
+// 数据只保存在当前进程里面，多个实例的时候每个实例各自限流
+type TokenBucket struct {
+	capacity int
+	interval time.Duration
+	mutex    sync.Mutex
+	buckets  map[string]*bucket
+	// 清理长时间没有使用的 key，避免内存一直增长
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(capacity int, interval time.Duration) *TokenBucket {
+	// 补充令牌的速率是 capacity/interval，任何一个为 0 都没有意义
+	if capacity <= 0 || interval <= 0 {
+		panic(fmt.Sprintf("ratelimit: 令牌桶的容量和补满的时间必须大于 0，capacity %d，interval %s", capacity, interval))
+	}
+	return &TokenBucket{
+		capacity: capacity,
+		interval: interval,
+		buckets:  map[string]*bucket{},
+		now:      time.Now,
+	}
+}
+
+func (t *TokenBucket) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	t.sweep(now)
+
+	// 每纳秒补充的令牌数量
+	rate := float64(t.capacity) / float64(t.interval)
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(t.capacity), last: now}
+		t.buckets[key] = b
+	}
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(t.capacity), b.tokens+float64(now.Sub(b.last))*rate)
+		b.last = now
+	}
+	res := ratelimit.Result{Limit: t.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Round((1 - b.tokens) / rate))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration(math.Round((float64(t.capacity) - b.tokens) / rate))
+	return res, nil
+}
+
+// sweep 每隔 interval 清理一次已经补满的桶，补满的桶和新建的桶没有区别
+func (t *TokenBucket) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.interval {
+		return
+	}
+	t.lastSweep = now
+	for key, b := range t.buckets {
+		if now.Sub(b.last) >= t.interval {
+			delete(t.buckets, key)
+		}
+	}
+}
+
+// SlidingWindow 滑动窗口，任意 window 长度的时间内最多通过 limit 个请求
+// 记录的是每个请求的时间，所以比令牌桶更精确，但是占用的内存和 limit 成正比
+// 数据只保存在当前进程里面，多个实例的时候每个实例各自限流
+type SlidingWindow struct {
+	limit     int
+	window    time.Duration
+	mutex     sync.Mutex
+	logs      map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	if limit <= 0 || window <= 0 {
+		panic(fmt.Sprintf("ratelimit: 滑动窗口的请求数量和窗口大小必须大于 0，limit %d，window %s", limit, window))
+	}
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		logs:   map[string][]time.Time{},
+		now:    time.Now,
+	}
+}
+
+func (s *SlidingWindow) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	s.sweep(now)
+
+	logs := expire(s.logs[key], now.Add(-s.window))
+	res := ratelimit.Result{Limit: s.limit}
+	if len(logs) < s.limit {
+		logs = append(logs, now)
+		res.Allowed = true
+	}
+	if len(logs) > 0 {
+		// 最早的请求滑出窗口之后，额度就会增加
+		res.Reset = logs[0].Add(s.window).Sub(now)
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.Reset
+	}
+	res.Remaining = s.limit - len(logs)
+	s.logs[key] = logs
+	return res, nil
+}
+
+// sweep 每隔 window 清理一次窗口内没有请求的 key
+func (s *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.window {
+		return
+	}
+	s.lastSweep = now
+	for key, logs := range s.logs {
+		if len(expire(logs, now.Add(-s.window))) == 0 {
+			delete(s.logs, key)
+		}
+	}
+}
+
+// expire 去掉 start 以及之前的请求，logs 是按照时间排好序的
+func expire(logs []time.Time, start time.Time) []time.Time {
+	i := 0
+	for i < len(logs) && !logs[i].After(start) {
+		i++
+	}
+	return logs[i:]
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"github.com/coderi421/kyuu/middleware/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tb := NewTokenBucket(2, time.Second*2)
+	tb.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		want    ratelimit.Result
+	}{
+		{
+			name: "first",
+			key:  "a",
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			name: "burst",
+			key:  "a",
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second * 2},
+		},
+		{
+			name: "empty",
+			key:  "a",
+			want: ratelimit.Result{Limit: 2, Remaining: 0, RetryAfter: time.Second, Reset: time.Second * 2},
+		},
+		{
+			name: "other key",
+			key:  "b",
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			name:    "half refilled",
+			advance: time.Millisecond * 500,
+			key:     "a",
+			want:    ratelimit.Result{Limit: 2, Remaining: 0, RetryAfter: time.Millisecond * 500, Reset: time.Millisecond * 1500},
+		},
+		{
+			name:    "refilled",
+			advance: time.Millisecond * 500,
+			key:     "a",
+			want:    ratelimit.Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second * 2},
+		},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		res, err := tb.Allow(context.Background(), step.key)
+		require.NoError(t, err)
+		assert.Equal(t, step.want, res, step.name)
+	}
+
+	// 补满之后的桶会被清理掉
+	now = now.Add(time.Second * 2)
+	_, err := tb.Allow(context.Background(), "c")
+	require.NoError(t, err)
+	assert.Len(t, tb.buckets, 1)
+}
+
+func TestSlidingWindow_Allow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	sw := NewSlidingWindow(2, time.Second)
+	sw.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		want    ratelimit.Result
+	}{
+		{
+			name: "first",
+			key:  "a",
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			name:    "second",
+			advance: time.Millisecond * 400,
+			key:     "a",
+			want:    ratelimit.Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Millisecond * 600},
+		},
+		{
+			name:    "limited",
+			advance: time.Millisecond * 100,
+			key:     "a",
+			want:    ratelimit.Result{Limit: 2, Remaining: 0, RetryAfter: time.Millisecond * 500, Reset: time.Millisecond * 500},
+		},
+		{
+			name: "other key",
+			key:  "b",
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			// 第一个请求滑出了窗口
+			name:    "slide",
+			advance: time.Millisecond * 500,
+			key:     "a",
+			want:    ratelimit.Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Millisecond * 400},
+		},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		res, err := sw.Allow(context.Background(), step.key)
+		require.NoError(t, err)
+		assert.Equal(t, step.want, res, step.name)
+	}
+
+	// 窗口内没有请求的 key 会被清理掉
+	now = now.Add(time.Second * 2)
+	_, err := sw.Allow(context.Background(), "c")
+	require.NoError(t, err)
+	assert.Len(t, sw.logs, 1)
+}
+
+func TestNewLimiter_invalid(t *testing.T) {
+	assert.PanicsWithValue(t, "ratelimit: 令牌桶的容量和补满的时间必须大于 0，capacity 0，interval 1s", func() {
+		NewTokenBucket(0, time.Second)
+	})
+	assert.Panics(t, func() {
+		NewTokenBucket(10, 0)
+	})
+	assert.PanicsWithValue(t, "ratelimit: 滑动窗口的请求数量和窗口大小必须大于 0，limit 10，window 0s", func() {
+		NewSlidingWindow(10, 0)
+	})
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/coderi421/kyuu"
+	"github.com/coderi421/kyuu/session"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limiter 限流算法，memory 和 redis 两个子包提供了令牌桶和滑动窗口的实现
+type Limiter interface {
+	// Allow 判断 key 对应的请求能否通过，能够通过的时候会消耗一次额度
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed bool
+	// Limit 窗口内允许的请求数量，或者令牌桶的容量
+	Limit int
+	// Remaining 剩余的额度
+	Remaining int
+	// RetryAfter 被拒绝的时候，多久之后可以重试
+	RetryAfter time.Duration
+	// Reset 多久之后额度会增加
+	Reset time.Duration
+}
+
+// KeyFunc 计算限流的 key，返回空字符串的时候不限流
+type KeyFunc func(ctx *kyuu.Context) string
+
+// MiddlewareBuilder 限流，被限流的请求响应 429，并且带上 Retry-After
+// 所有的响应都会带上 RateLimit-Limit、RateLimit-Remaining 和 RateLimit-Reset
+//
+//	login := ratelimit.NewBuilder(memory.NewSlidingWindow(5, time.Minute)).Build()
+//	s.Group("/login", login).Post("/", handler)
+type MiddlewareBuilder struct {
+	limiter Limiter
+	keyFunc KeyFunc
+	prefix  string
+	data    []byte
+}
+
+// NewBuilder 默认按照客户端 IP 限流
+func NewBuilder(limiter Limiter) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		limiter: limiter,
+		keyFunc: KeyByIP,
+		prefix:  "ratelimit",
+		data:    []byte(http.StatusText(http.StatusTooManyRequests)),
+	}
+}
+
+// KeyFunc 设置限流的 key，例如 KeyByRoute、KeyBySession，或者用 Join 组合起来
+func (m *MiddlewareBuilder) KeyFunc(fn KeyFunc) *MiddlewareBuilder {
+	m.keyFunc = fn
+	return m
+}
+
+// Prefix key 的前缀，默认是 ratelimit
+// 不同的接口共用一个 Limiter 的时候，用不同的前缀区分开
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+// Data 被限流时的响应数据
+func (m *MiddlewareBuilder) Data(data []byte) *MiddlewareBuilder {
+	m.data = data
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			key := m.keyFunc(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+			res, err := m.limiter.Allow(ctx.Req.Context(), m.prefix+":"+key)
+			if err != nil {
+				// 限流本身出了问题，例如 Redis 不可用，不应该影响业务
+				log.Printf("ratelimit: 限流失败 %s %v", key, err)
+				next(ctx)
+				return
+			}
+			header := ctx.Resp.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				header.Set("Retry-After", seconds(res.RetryAfter))
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+				ctx.RespData = m.data
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// seconds 向上取整到秒
+func seconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// KeyByIP 按照客户端 IP 限流，使用的是 RemoteAddr
+// 部署在代理后面的时候，需要先把 RemoteAddr 还原成真实的客户端地址，或者使用 KeyByHeader
+func KeyByIP(ctx *kyuu.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		return "ip:" + ctx.Req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByHeader 按照请求头限流，例如代理设置的 X-Real-IP，或者 API Key
+// 请求头为空的时候不限流
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *kyuu.Context) string {
+		val := ctx.Req.Header.Get(name)
+		if val == "" {
+			return ""
+		}
+		return "header:" + val
+	}
+}
+
+// KeyByRoute 按照命中的路由限流，所有客户端共享额度
+// MatchedRoute 在路由匹配之后才有值，所以只能注册在路由或者分组上
+func KeyByRoute(ctx *kyuu.Context) string {
+	return "route:" + ctx.Req.Method + " " + ctx.MatchedRoute
+}
+
+// KeyBySession 按照 session 限流，没有 session 的时候按照客户端 IP 限流
+func KeyBySession(m *session.Manager) KeyFunc {
+	return func(ctx *kyuu.Context) string {
+		sess, err := m.GetSession(ctx)
+		if err != nil {
+			return KeyByIP(ctx)
+		}
+		return "session:" + sess.ID()
+	}
+}
+
+// Join 组合多个 KeyFunc，例如 Join(KeyByRoute, KeyByIP) 是每个客户端在每个路由上各自的额度
+// 任何一个返回空字符串的时候不限流
+func Join(fns ...KeyFunc) KeyFunc {
+	return func(ctx *kyuu.Context) string {
+		keys := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			key := fn(ctx)
+			if key == "" {
+				return ""
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, ":")
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/coderi421/kyuu"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name       string
+		limiter    *fakeLimiter
+		builder    func(b *MiddlewareBuilder) *MiddlewareBuilder
+		wantKey    string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name: "allowed",
+			limiter: &fakeLimiter{res: Result{
+				Allowed: true, Limit: 10, Remaining: 9, Reset: time.Millisecond * 1500,
+			}},
+			wantKey:  "ratelimit:ip:192.0.2.1",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+			wantHeader: map[string]string{
+				"RateLimit-Limit":     "10",
+				"RateLimit-Remaining": "9",
+				"RateLimit-Reset":     "2",
+				"Retry-After":         "",
+			},
+		},
+		{
+			name: "limited",
+			limiter: &fakeLimiter{res: Result{
+				Limit: 10, RetryAfter: time.Second * 3, Reset: time.Second * 3,
+			}},
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.Prefix("login").KeyFunc(Join(KeyByRoute, KeyByIP))
+			},
+			wantKey:  "login:route:GET /user/:id:ip:192.0.2.1",
+			wantCode: http.StatusTooManyRequests,
+			wantBody: "Too Many Requests",
+			wantHeader: map[string]string{
+				"RateLimit-Limit":     "10",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "3",
+				"Retry-After":         "3",
+			},
+		},
+		{
+			// 限流失败的时候放行
+			name:     "limiter error",
+			limiter:  &fakeLimiter{err: errors.New("redis down")},
+			wantKey:  "ratelimit:ip:192.0.2.1",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+			wantHeader: map[string]string{
+				"RateLimit-Limit": "",
+			},
+		},
+		{
+			name:    "empty key",
+			limiter: &fakeLimiter{res: Result{}},
+			builder: func(b *MiddlewareBuilder) *MiddlewareBuilder {
+				return b.KeyFunc(KeyByHeader("X-API-Key"))
+			},
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBuilder(tc.limiter)
+			if tc.builder != nil {
+				b = tc.builder(b)
+			}
+			s := kyuu.NewHTTPServer()
+			s.Group("/user", b.Build()).Get("/:id", func(ctx *kyuu.Context) {
+				ctx.RespString(http.StatusOK, "ok")
+			})
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+			assert.Equal(t, tc.wantKey, tc.limiter.key)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, recorder.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+type fakeLimiter struct {
+	key string
+	res Result
+	err error
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	f.key = key
+	return f.res, f.err
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/coderi421/kyuu/middleware/ratelimit"
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	_ ratelimit.Limiter = (*TokenBucket)(nil)
+	_ ratelimit.Limiter = (*SlidingWindow)(nil)
+)
+
+var (
+	//go:embed token_bucket.lua
+	luaTokenBucket string
+	//go:embed sliding_window.lua
+	luaSlidingWindow string
+)
+
+var errUnexpectedResult = errors.New("redis-ratelimit: 限流脚本返回了非法的结果")
+
+// TokenBucket 基于 Redis 的令牌桶，多个实例共享额度，算法和 memory.TokenBucket 一样
+// 使用的是应用服务器的时间，所以各个实例的时间需要同步
+type TokenBucket struct {
+	client   redis.Cmdable
+	capacity int
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewTokenBucket 脚本里面使用毫秒计算，所以 interval 至少是 1 毫秒
+func NewTokenBucket(client redis.Cmdable, capacity int, interval time.Duration) *TokenBucket {
+	if capacity <= 0 || interval < time.Millisecond {
+		panic(fmt.Sprintf("redis-ratelimit: 令牌桶的容量必须大于 0，补满的时间至少是 1 毫秒，capacity %d，interval %s", capacity, interval))
+	}
+	return &TokenBucket{
+		client:   client,
+		capacity: capacity,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+func (t *TokenBucket) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	vals, err := t.client.Eval(ctx, luaTokenBucket, []string{key},
+		t.capacity, t.interval.Milliseconds(), t.now().UnixMilli()).Slice()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	if len(vals) != 2 {
+		return ratelimit.Result{}, errUnexpectedResult
+	}
+	allowed, ok := vals[0].(int64)
+	if !ok {
+		return ratelimit.Result{}, errUnexpectedResult
+	}
+	// 令牌数量是小数，Lua 返回数字的时候会被截断成整数，所以脚本返回的是字符串
+	str, ok := vals[1].(string)
+	if !ok {
+		return ratelimit.Result{}, errUnexpectedResult
+	}
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("redis-ratelimit: 非法的令牌数量 %w", err)
+	}
+
+	// 每毫秒补充的令牌数量
+	rate := float64(t.capacity) / float64(t.interval.Milliseconds())
+	res := ratelimit.Result{
+		Allowed:   allowed == 1,
+		Limit:     t.capacity,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(t.capacity)-tokens)/rate) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	return res, nil
+}
+
+// SlidingWindow 基于 Redis 的滑动窗口，多个实例共享额度，算法和 memory.SlidingWindow 一样
+// 每个请求是有序集合里面的一个元素，所以占用的内存和 limit 成正比
+// 使用的是应用服务器的时间，所以各个实例的时间需要同步
+type SlidingWindow struct {
+	client redis.Cmdable
+	limit  int
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewSlidingWindow 脚本里面使用毫秒计算，所以 window 至少是 1 毫秒
+func NewSlidingWindow(client redis.Cmdable, limit int, window time.Duration) *SlidingWindow {
+	if limit <= 0 || window < time.Millisecond {
+		panic(fmt.Sprintf("redis-ratelimit: 滑动窗口的请求数量必须大于 0，窗口大小至少是 1 毫秒，limit %d，window %s", limit, window))
+	}
+	return &SlidingWindow{
+		client: client,
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+func (s *SlidingWindow) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	now := s.now().UnixMilli()
+	// 同一毫秒内可能有多个请求，所以元素不能只用时间
+	vals, err := s.client.Eval(ctx, luaSlidingWindow, []string{key},
+		s.limit, s.window.Milliseconds(), now, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	if len(vals) != 3 {
+		return ratelimit.Result{}, errUnexpectedResult
+	}
+	allowed, count, oldest := vals[0] == 1, int(vals[1]), vals[2]
+	res := ratelimit.Result{
+		Allowed:   allowed,
+		Limit:     s.limit,
+		Remaining: s.limit - count,
+	}
+	if count > 0 {
+		res.Reset = time.Duration(oldest+s.window.Milliseconds()-now) * time.Millisecond
+	}
+	if !allowed {
+		res.RetryAfter = res.Reset
+	}
+	return res, nil
+}
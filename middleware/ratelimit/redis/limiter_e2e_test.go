@@ -0,0 +1,72 @@
+//go:build e2e
+
+package redis
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Allow_e2e(t *testing.T) {
+	rc := newClient()
+	ctx := context.Background()
+	key := "ratelimit:test:token_bucket"
+	defer rc.Del(ctx, key)
+	tb := NewTokenBucket(rc, 2, time.Second*2)
+	now := time.UnixMilli(1000000)
+	tb.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		res, err := tb.Allow(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 1-i, res.Remaining)
+	}
+	res, err := tb.Allow(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	now = now.Add(time.Second)
+	res, err = tb.Allow(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindow_Allow_e2e(t *testing.T) {
+	rc := newClient()
+	ctx := context.Background()
+	key := "ratelimit:test:sliding_window"
+	defer rc.Del(ctx, key)
+	sw := NewSlidingWindow(rc, 2, time.Second)
+	now := time.UnixMilli(1000000)
+	sw.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		res, err := sw.Allow(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		now = now.Add(time.Millisecond * 400)
+	}
+	res, err := sw.Allow(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Millisecond*200, res.RetryAfter)
+
+	now = now.Add(time.Millisecond * 200)
+	res, err = sw.Allow(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func newClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "abc",
+	})
+}
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"github.com/coderi421/kyuu/middleware/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     any
+		err     error
+		want    ratelimit.Result
+		wantErr error
+	}{
+		{
+			name: "allowed",
+			val:  []any{int64(1), "1.5"},
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Millisecond * 500},
+		},
+		{
+			name: "limited",
+			val:  []any{int64(0), "0.25"},
+			want: ratelimit.Result{Limit: 2, Remaining: 0, RetryAfter: time.Millisecond * 750, Reset: time.Millisecond * 1750},
+		},
+		{
+			name:    "redis error",
+			err:     redis.ErrClosed,
+			wantErr: redis.ErrClosed,
+		},
+		{
+			name:    "unexpected result",
+			val:     []any{int64(1)},
+			wantErr: errUnexpectedResult,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tb := NewTokenBucket(&evalCmdable{val: tc.val, err: tc.err}, 2, time.Second*2)
+			res, err := tb.Allow(context.Background(), "key")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestSlidingWindow_Allow(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     any
+		want    ratelimit.Result
+		wantErr error
+	}{
+		{
+			name: "allowed",
+			val:  []any{int64(1), int64(1), int64(1000)},
+			want: ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		},
+		{
+			name: "limited",
+			val:  []any{int64(0), int64(2), int64(400)},
+			want: ratelimit.Result{Limit: 2, Remaining: 0, RetryAfter: time.Millisecond * 400, Reset: time.Millisecond * 400},
+		},
+		{
+			name:    "unexpected result",
+			val:     []any{int64(1), int64(1)},
+			wantErr: errUnexpectedResult,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sw := NewSlidingWindow(&evalCmdable{val: tc.val}, 2, time.Second)
+			sw.now = func() time.Time { return time.UnixMilli(1000) }
+			res, err := sw.Allow(context.Background(), "key")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+// evalCmdable 只实现了 Eval，直接返回预设的结果
+type evalCmdable struct {
+	redis.Cmdable
+	val any
+	err error
+}
+
+func (e *evalCmdable) Eval(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+	cmd := redis.NewCmd(ctx)
+	if e.err != nil {
+		cmd.SetErr(e.err)
+		return cmd
+	}
+	cmd.SetVal(e.val)
+	return cmd
+}
+
+func TestNewLimiter_invalid(t *testing.T) {
+	assert.PanicsWithValue(t, "redis-ratelimit: 令牌桶的容量必须大于 0，补满的时间至少是 1 毫秒，capacity 10，interval 1µs", func() {
+		NewTokenBucket(&evalCmdable{}, 10, time.Microsecond)
+	})
+	assert.Panics(t, func() {
+		NewTokenBucket(&evalCmdable{}, 0, time.Second)
+	})
+	assert.PanicsWithValue(t, "redis-ratelimit: 滑动窗口的请求数量必须大于 0，窗口大小至少是 1 毫秒，limit 0，window 1s", func() {
+		NewSlidingWindow(&evalCmdable{}, 0, time.Second)
+	})
+	assert.Panics(t, func() {
+		NewSlidingWindow(&evalCmdable{}, 10, time.Microsecond)
+	})
+}
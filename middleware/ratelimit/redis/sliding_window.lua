@@ -0,0 +1,23 @@
+-- KEYS[1] 窗口的 key
+-- ARGV[1] 窗口内允许的请求数量，ARGV[2] 窗口的毫秒数，ARGV[3] 当前时间的毫秒数，ARGV[4] 这次请求的唯一标识
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+local count = redis.call("zcard", KEYS[1])
+local allowed = 0
+if count < limit then
+    redis.call("zadd", KEYS[1], now, ARGV[4])
+    count = count + 1
+    allowed = 1
+end
+redis.call("pexpire", KEYS[1], window)
+
+-- 最早的请求滑出窗口之后，额度就会增加
+local oldest = now
+local first = redis.call("zrange", KEYS[1], 0, 0, "withscores")
+if first[2] then
+    oldest = tonumber(first[2])
+end
+return { allowed, count, oldest }
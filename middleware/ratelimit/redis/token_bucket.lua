@@ -0,0 +1,28 @@
+-- KEYS[1] 桶的 key
+-- ARGV[1] 容量，ARGV[2] 补满需要的毫秒数，ARGV[3] 当前时间的毫秒数
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local rate = capacity / interval
+
+local state = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+    tokens = capacity
+    ts = now
+end
+if now > ts then
+    tokens = math.min(capacity, tokens + (now - ts) * rate)
+    ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+end
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "ts", ts)
+-- 补满之后和新建的桶没有区别，可以过期
+redis.call("pexpire", KEYS[1], interval)
+return { allowed, tostring(tokens) }
@@ -1,17 +1,27 @@
 package recover
 
-import "github.com/coderi421/kyuu"
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/coderi421/kyuu/middleware/requestid"
+	"log"
+	"runtime/debug"
+)
 
 type MiddlewareBuilder struct {
 	StatusCode int
 	Data       []byte
-	LogFunc    func(ctx *kyuu.Context, err any)
+	// LogFunc 为 nil 的时候使用 log 打印 panic 和调用栈，注册了 requestid 的时候会带上请求 ID
+	// 自定义的 LogFunc 可以通过 requestid.Get(ctx) 拿到请求 ID
+	LogFunc func(ctx *kyuu.Context, err any)
 	// log func(err any)
 	// LogFunc func(ctx *web.Context)
 	// log func(stack string)
 }
 
 func (m *MiddlewareBuilder) Builder() kyuu.Middleware {
+	if m.LogFunc == nil {
+		m.LogFunc = defaultLogFunc
+	}
 	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
 		return func(ctx *kyuu.Context) {
 			defer func() {
@@ -26,3 +36,11 @@ func (m *MiddlewareBuilder) Builder() kyuu.Middleware {
 		}
 	}
 }
+
+func defaultLogFunc(ctx *kyuu.Context, err any) {
+	if id := requestid.Get(ctx); id != "" {
+		log.Printf("recover: panic request_id=%s %s %s %v\n%s", id, ctx.Req.Method, ctx.Req.URL.Path, err, debug.Stack())
+		return
+	}
+	log.Printf("recover: panic %s %s %v\n%s", ctx.Req.Method, ctx.Req.URL.Path, err, debug.Stack())
+}
@@ -0,0 +1,18 @@
+// Package ctxkey 定义请求 ID 在 context 里面的 key
+// 它不依赖 kyuu 的 Web 部分，所以 ORM 之类拿不到 kyuu.Context 的地方也可以读取请求 ID
+package ctxkey
+
+import "context"
+
+type requestIDKey struct{}
+
+// NewContext 把请求 ID 放进 context
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext 读取请求 ID，没有的时候返回 false
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
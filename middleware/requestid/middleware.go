@@ -0,0 +1,93 @@
+package requestid
+
+import (
+	"context"
+	"github.com/coderi421/kyuu"
+	"github.com/coderi421/kyuu/middleware/requestid/ctxkey"
+	"github.com/google/uuid"
+)
+
+// HeaderName 默认的请求头和响应头
+const HeaderName = "X-Request-ID"
+
+// UserValueKey 请求 ID 在 ctx.UserValues 里面的 key
+const UserValueKey = "request_id"
+
+// 请求头里面的 ID 是客户端控制的，太长或者包含控制字符的时候重新生成，避免污染日志
+const maxLength = 128
+
+// MiddlewareBuilder 给每个请求分配一个 ID，用于关联同一个请求的访问日志、panic 日志和 SQL 日志
+// 请求头里面有 ID 的时候沿用，否则生成一个新的 UUID；响应里面会带上这个 ID
+// ID 会放进 ctx.Req.Context() 和 ctx.UserValues，accesslog、recover 以及 ORM 的
+// querylog、slowquery 会自动把它打印出来，所以应该注册在这些 middleware 之前
+type MiddlewareBuilder struct {
+	header    string
+	generator func() string
+}
+
+func NewBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		header:    HeaderName,
+		generator: uuid.NewString,
+	}
+}
+
+// Header 读取和回写 ID 的头部，默认是 X-Request-ID
+func (m *MiddlewareBuilder) Header(name string) *MiddlewareBuilder {
+	m.header = name
+	return m
+}
+
+// Generator 生成 ID 的方法，默认是 UUID
+func (m *MiddlewareBuilder) Generator(fn func() string) *MiddlewareBuilder {
+	m.generator = fn
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			id := ctx.Req.Header.Get(m.header)
+			if !valid(id) {
+				id = m.generator()
+			}
+			ctx.Req = ctx.Req.WithContext(NewContext(ctx.Req.Context(), id))
+			if ctx.UserValues == nil {
+				ctx.UserValues = map[string]any{}
+			}
+			ctx.UserValues[UserValueKey] = id
+			ctx.Resp.Header().Set(m.header, id)
+			next(ctx)
+		}
+	}
+}
+
+// valid 只接受可见的 ASCII 字符
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext 把请求 ID 放进 context，调用下游服务或者在 goroutine 里面处理的时候可以继续传递
+func NewContext(ctx context.Context, id string) context.Context {
+	return ctxkey.NewContext(ctx, id)
+}
+
+// FromContext 读取请求 ID，和 ctxkey.FromContext 一样
+// 不想依赖 kyuu 的地方，例如 ORM，直接使用 ctxkey
+func FromContext(ctx context.Context) (string, bool) {
+	return ctxkey.FromContext(ctx)
+}
+
+// Get 读取当前请求的 ID，没有经过 middleware 的时候返回空字符串
+func Get(ctx *kyuu.Context) string {
+	id, _ := FromContext(ctx.Req.Context())
+	return id
+}
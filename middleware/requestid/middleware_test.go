@@ -0,0 +1,94 @@
+package requestid
+
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		header  map[string]string
+		// 为空的时候检查是不是生成的 UUID
+		wantID     string
+		wantHeader string
+	}{
+		{
+			name:       "generate",
+			builder:    NewBuilder(),
+			wantHeader: HeaderName,
+		},
+		{
+			name:       "reuse",
+			builder:    NewBuilder(),
+			header:     map[string]string{HeaderName: "abc-123"},
+			wantID:     "abc-123",
+			wantHeader: HeaderName,
+		},
+		{
+			name:       "invalid",
+			builder:    NewBuilder(),
+			header:     map[string]string{HeaderName: "abc\x00123"},
+			wantHeader: HeaderName,
+		},
+		{
+			name:       "too long",
+			builder:    NewBuilder(),
+			header:     map[string]string{HeaderName: strings.Repeat("a", maxLength+1)},
+			wantHeader: HeaderName,
+		},
+		{
+			name: "custom",
+			builder: NewBuilder().Header("X-Trace-ID").Generator(func() string {
+				return "fixed"
+			}),
+			header:     map[string]string{HeaderName: "abc-123"},
+			wantID:     "fixed",
+			wantHeader: "X-Trace-ID",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var id, userValue string
+			s := kyuu.NewHTTPServer()
+			s.Use(tc.builder.Build())
+			s.Get("/user", func(ctx *kyuu.Context) {
+				id = Get(ctx)
+				userValue, _ = ctx.UserValues[UserValueKey].(string)
+				ctx.RespString(http.StatusOK, "ok")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+
+			if tc.wantID == "" {
+				_, err := uuid.Parse(id)
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tc.wantID, id)
+			}
+			assert.Equal(t, id, userValue)
+			assert.Equal(t, id, recorder.Header().Get(tc.wantHeader))
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	_, ok := FromContext(req.Context())
+	assert.False(t, ok)
+	assert.Equal(t, "", Get(&kyuu.Context{Req: req}))
+
+	id, ok := FromContext(NewContext(req.Context(), "abc"))
+	assert.True(t, ok)
+	assert.Equal(t, "abc", id)
+}
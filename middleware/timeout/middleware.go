@@ -0,0 +1,184 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/coderi421/kyuu"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// MiddlewareBuilder 超时控制
+// 它会给 ctx.Req.Context() 设置截止时间，所以使用这个 context 的数据库查询之类的操作也会被取消
+// 超时之后立刻返回 StatusCode 和 Data，业务逻辑在超时之后写入的响应会被丢弃
+// 业务逻辑是在另外一个 goroutine 里面执行的，所以不支持流式响应和 WebSocket
+type MiddlewareBuilder struct {
+	timeout    time.Duration
+	statusCode int
+	data       []byte
+}
+
+func NewBuilder(timeout time.Duration) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		timeout:    timeout,
+		statusCode: http.StatusServiceUnavailable,
+		data:       []byte(http.StatusText(http.StatusServiceUnavailable)),
+	}
+}
+
+// StatusCode 超时的响应码，默认是 503，网关之类的场景可以改成 504
+func (m *MiddlewareBuilder) StatusCode(code int) *MiddlewareBuilder {
+	m.statusCode = code
+	return m
+}
+
+// Data 超时的响应数据
+func (m *MiddlewareBuilder) Data(data []byte) *MiddlewareBuilder {
+	m.data = data
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() kyuu.Middleware {
+	return func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			c, cancel := context.WithTimeout(ctx.Req.Context(), m.timeout)
+			defer cancel()
+
+			// 业务逻辑在另外一个 goroutine 里面使用复制出来的 Context，
+			// 超时之后它对 Context 的修改不会影响这边
+			tw := &timeoutWriter{header: http.Header{}, ctx: c}
+			shadow := ctx.Clone()
+			shadow.Req = ctx.Req.WithContext(c)
+			shadow.Resp = tw
+
+			done := make(chan struct{})
+			panicChan := make(chan *PanicError, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						// 调用栈只有在发生 panic 的 goroutine 里面才拿得到
+						panicChan <- &PanicError{Value: p, Stack: debug.Stack()}
+					}
+				}()
+				next(shadow)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// 交给外层的 recover 处理，recover 拿到的是 *PanicError
+				panic(p)
+			case <-done:
+				if c.Err() != nil {
+					// 业务逻辑刚好在超时的时候结束，它的写入可能已经失败了
+					m.respTimeout(ctx, tw)
+					return
+				}
+				// 只复制响应相关的字段，Req 里面的 context 在返回之后就被取消了，
+				// 外层的 middleware 应该看到原本的 Req
+				ctx.RespStatusCode = shadow.RespStatusCode
+				ctx.RespData = shadow.RespData
+				ctx.UserValues = shadow.UserValues
+				ctx.MatchedRoute = shadow.MatchedRoute
+				if shadow.IsAborted() {
+					ctx.Abort()
+				}
+				tw.flush(ctx)
+			case <-c.Done():
+				m.respTimeout(ctx, tw)
+			}
+		}
+	}
+}
+
+// PanicError 业务逻辑在另外一个 goroutine 里面 panic 的时候，重新 panic 的值
+// 重新 panic 之后调用栈是当前 goroutine 的，所以把原本的调用栈一起带上
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n%s", p.Value, p.Stack)
+}
+
+func (m *MiddlewareBuilder) respTimeout(ctx *kyuu.Context, tw *timeoutWriter) {
+	tw.timeout()
+	ctx.RespStatusCode = m.statusCode
+	ctx.RespData = m.data
+}
+
+// Remaining 返回请求剩余的时间，没有设置超时的时候返回 false
+// 可以用来决定要不要执行一个耗时的操作，或者给下游服务设置超时时间
+func Remaining(ctx *kyuu.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Req.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// timeoutWriter 缓存业务逻辑直接写入的响应，超时之后的写入都会失败
+type timeoutWriter struct {
+	// 超过截止时间之后，即便还没有调用 timeout，写入也会失败
+	ctx         context.Context
+	mutex       sync.Mutex
+	header      http.Header
+	code        int
+	buf         bytes.Buffer
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.timedOut || w.ctx.Err() != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		w.writeHeaderLocked(http.StatusOK)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.timedOut || w.wroteHeader || w.ctx.Err() != nil {
+		return
+	}
+	w.writeHeaderLocked(code)
+}
+
+func (w *timeoutWriter) writeHeaderLocked(code int) {
+	w.wroteHeader = true
+	w.code = code
+}
+
+func (w *timeoutWriter) timeout() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.timedOut = true
+}
+
+// flush 业务逻辑按时完成，将缓存的响应头和直接写入的数据写到真正的 ResponseWriter
+// 使用 RespData 的响应依旧由框架回写
+func (w *timeoutWriter) flush(ctx *kyuu.Context) {
+	dst := ctx.Resp.Header()
+	for k, vv := range w.header {
+		dst[k] = vv
+	}
+	if !w.wroteHeader {
+		return
+	}
+	ctx.Resp.WriteHeader(w.code)
+	_, _ = ctx.Resp.Write(w.buf.Bytes())
+}
@@ -0,0 +1,168 @@
+package timeout
+
+import (
+	"github.com/coderi421/kyuu"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	lateErr := make(chan error, 1)
+	s := kyuu.NewHTTPServer()
+	s.Use(NewBuilder(time.Millisecond * 100).Build())
+	s.Get("/fast", func(ctx *kyuu.Context) {
+		remaining, ok := Remaining(ctx)
+		assert.True(t, ok)
+		assert.True(t, remaining > 0 && remaining <= time.Millisecond*100)
+		ctx.Resp.Header().Set("X-Handler", "fast")
+		ctx.PathParams = map[string]string{"changed": "true"}
+		ctx.RespString(http.StatusOK, "fast")
+	})
+	s.Get("/slow", func(ctx *kyuu.Context) {
+		// 模拟使用请求的 context 执行的数据库查询
+		<-ctx.Req.Context().Done()
+		ctx.Resp.Header().Set("X-Handler", "slow")
+		_, err := ctx.Resp.Write([]byte("late"))
+		lateErr <- err
+	})
+	// 单个路由上的超时时间更短
+	gateway := s.Group("/gateway", NewBuilder(time.Millisecond*10).StatusCode(http.StatusGatewayTimeout).Data([]byte("timeout")).Build())
+	gateway.Get("/", func(ctx *kyuu.Context) {
+		remaining, _ := Remaining(ctx)
+		assert.True(t, remaining <= time.Millisecond*10)
+		time.Sleep(time.Millisecond * 50)
+		ctx.RespString(http.StatusOK, "late")
+	})
+	s.Get("/file", func(ctx *kyuu.Context) {
+		ctx.Resp.WriteHeader(http.StatusAccepted)
+		_, _ = ctx.Resp.Write([]byte("direct"))
+	})
+
+	testCases := []struct {
+		name        string
+		path        string
+		wantCode    int
+		wantBody    string
+		wantHandler string
+	}{
+		{
+			name:        "fast",
+			path:        "/fast",
+			wantCode:    http.StatusOK,
+			wantBody:    "fast",
+			wantHandler: "fast",
+		},
+		{
+			name:     "slow",
+			path:     "/slow",
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "Service Unavailable",
+		},
+		{
+			name:     "route timeout",
+			path:     "/gateway",
+			wantCode: http.StatusGatewayTimeout,
+			wantBody: "timeout",
+		},
+		{
+			name:     "direct write",
+			path:     "/file",
+			wantCode: http.StatusAccepted,
+			wantBody: "direct",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantHandler, recorder.Header().Get("X-Handler"))
+		})
+	}
+
+	// 超时之后，业务逻辑的写入会失败
+	select {
+	case err := <-lateErr:
+		assert.Equal(t, http.ErrHandlerTimeout, err)
+	case <-time.After(time.Second):
+		t.Fatal("业务逻辑没有感知到超时")
+	}
+}
+
+func TestMiddlewareBuilder_Panic(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	var recovered any
+	s.Use(func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			defer func() {
+				recovered = recover()
+				ctx.RespStatusCode = http.StatusInternalServerError
+			}()
+			next(ctx)
+		}
+	}, NewBuilder(time.Second).Build())
+	s.Get("/panic", func(ctx *kyuu.Context) {
+		panic("boom")
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	pe, ok := recovered.(*PanicError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "boom", pe.Value)
+		// 带上的是业务逻辑所在 goroutine 的调用栈
+		assert.Contains(t, string(pe.Stack), "TestMiddlewareBuilder_Panic.func")
+	}
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestMiddlewareBuilder_Build_outerContext(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	var reqErr error
+	var userValue any
+	s.Use(func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			next(ctx)
+			// 外层的 middleware 看到的依旧是原本的 Req，它的 context 没有被取消
+			reqErr = ctx.Req.Context().Err()
+			userValue = ctx.UserValues["user"]
+		}
+	}, NewBuilder(time.Second).Build())
+	s.Get("/user/:id", func(ctx *kyuu.Context) {
+		ctx.UserValues = map[string]any{"user": "Tom"}
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, reqErr)
+	assert.Equal(t, "Tom", userValue)
+}
+
+func TestMiddlewareBuilder_Build_abort(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	var aborted bool
+	s.Use(func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			next(ctx)
+			// 业务逻辑里面调用的 Abort 外层也能看到
+			aborted = ctx.IsAborted()
+		}
+	}, NewBuilder(time.Second).Build())
+	s.Get("/user/:id", func(ctx *kyuu.Context) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.True(t, aborted)
+}
+
+func TestRemaining(t *testing.T) {
+	ctx := &kyuu.Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}
+	_, ok := Remaining(ctx)
+	assert.False(t, ok)
+}
@@ -0,0 +1,186 @@
+package kyuu
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContext_Abort(t *testing.T) {
+	var mdlBuilder = func(i byte) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.RespData = append(ctx.RespData, i)
+				next(ctx)
+			}
+		}
+	}
+	// auth 调用了 Abort 之后依旧调用 next，后续的 middleware 和业务逻辑都不会执行
+	auth := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.Header.Get("Authorization") == "" {
+				ctx.AbortWithStatus(http.StatusUnauthorized)
+			}
+			next(ctx)
+		}
+	}
+	var aborted bool
+	s := NewHTTPServer()
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			aborted = ctx.IsAborted()
+		}
+	}, mdlBuilder('a'))
+	s.Get("/global", func(ctx *Context) {
+		ctx.RespData = append(ctx.RespData, 'h')
+	})
+	s.Group("/route", mdlBuilder('g'), auth, mdlBuilder('r')).Get("/", func(ctx *Context) {
+		ctx.RespData = append(ctx.RespData, 'h')
+	})
+	s.Use(auth, mdlBuilder('b'))
+
+	testCases := []struct {
+		name        string
+		path        string
+		auth        bool
+		wantCode    int
+		wantBody    string
+		wantAborted bool
+	}{
+		{
+			name:     "global",
+			path:     "/global",
+			auth:     true,
+			wantCode: http.StatusOK,
+			wantBody: "abh",
+		},
+		{
+			name:        "global abort",
+			path:        "/global",
+			wantCode:    http.StatusUnauthorized,
+			wantBody:    "a",
+			wantAborted: true,
+		},
+		{
+			// 全局的 middleware 中断之后不会执行路由匹配，所以也不会 404
+			name:        "global abort not found",
+			path:        "/not-found",
+			wantCode:    http.StatusUnauthorized,
+			wantBody:    "a",
+			wantAborted: true,
+		},
+		{
+			name:     "route",
+			path:     "/route",
+			auth:     true,
+			wantCode: http.StatusOK,
+			wantBody: "abgrh",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.auth {
+				req.Header.Set("Authorization", "token")
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantAborted, aborted)
+		})
+	}
+
+	// 路由上的 middleware 中断
+	s = NewHTTPServer()
+	s.Group("/route", mdlBuilder('g'), func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			next(ctx)
+		}
+	}, mdlBuilder('r')).Get("/", func(ctx *Context) {
+		ctx.RespData = append(ctx.RespData, 'h')
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/route", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "g", recorder.Body.String())
+
+	// Context 复用之后不再是中断的状态
+	s.Get("/", func(ctx *Context) {
+		ctx.RespString(http.StatusOK, "ok")
+	})
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestSkip(t *testing.T) {
+	mark := func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			ctx.RespData = append(ctx.RespData, '!')
+		}
+	}
+	s := NewHTTPServer()
+	s.Use(
+		Skip(func(ctx *Context) bool {
+			return ctx.Req.Header.Get("X-Skip") != ""
+		}, mark),
+		OnlyRoutes([]string{"/user/:id", "/admin/*"}, mark),
+	)
+	handler := func(ctx *Context) {
+		ctx.RespString(http.StatusOK, "h")
+	}
+	s.Get("/user/:id", handler)
+	s.Get("/user/:id/profile", handler)
+	s.Post("/admin/user/create", handler)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		skip     bool
+		wantBody string
+	}{
+		{
+			name:     "both",
+			method:   http.MethodGet,
+			path:     "/user/1",
+			wantBody: "h!!",
+		},
+		{
+			name:     "skip",
+			method:   http.MethodGet,
+			path:     "/user/1",
+			skip:     true,
+			wantBody: "h!",
+		},
+		{
+			name:     "not in routes",
+			method:   http.MethodGet,
+			path:     "/user/1/profile",
+			wantBody: "h!",
+		},
+		{
+			name:     "wildcard",
+			method:   http.MethodPost,
+			path:     "/admin/user/create",
+			skip:     true,
+			wantBody: "h!",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.skip {
+				req.Header.Set("X-Skip", "1")
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package kyuu
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoder 将数据编码为某种格式，用于内容协商
+// 例如 protobuf、msgpack 都可以实现这个接口，然后通过 ServerWithEncoder 注册
+type Encoder interface {
+	Encode(data any) ([]byte, error)
+}
+
+// EncoderFunc 函数形式的 Encoder
+type EncoderFunc func(data any) ([]byte, error)
+
+func (f EncoderFunc) Encode(data any) ([]byte, error) {
+	return f(data)
+}
+
+var ErrNotAcceptable = errors.New("kyuu: 没有能够满足 Accept 的格式")
+
+type encoderEntry struct {
+	// 响应的 Content-Type，可以带上 charset 之类的参数
+	contentType string
+	// 用于匹配 Accept 的 type/subtype
+	mediaType string
+	encoder   Encoder
+}
+
+// defaultEncoders 默认支持的格式，Accept 为空或者是 */* 的时候使用第一个
+var defaultEncoders = []encoderEntry{
+	newEncoderEntry("application/json", EncoderFunc(json.Marshal)),
+	newEncoderEntry("application/xml; charset=utf-8", EncoderFunc(xml.Marshal)),
+	newEncoderEntry("text/html; charset=utf-8", EncoderFunc(encodeHTML)),
+	newEncoderEntry("text/plain; charset=utf-8", EncoderFunc(encodePlain)),
+}
+
+func newEncoderEntry(contentType string, enc Encoder) encoderEntry {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		panic(fmt.Sprintf("kyuu: 非法的 Content-Type %s", contentType))
+	}
+	return encoderEntry{contentType: contentType, mediaType: mediaType, encoder: enc}
+}
+
+// ServerWithEncoder 注册内容协商使用的 Encoder
+// contentType 是响应的 Content-Type，例如 application/x-protobuf
+// 已经存在的格式会被替换，例如可以用它替换默认的 JSON 实现
+func ServerWithEncoder(contentType string, enc Encoder) HTTPServerOption {
+	return func(server *HTTPServer) {
+		entry := newEncoderEntry(contentType, enc)
+		for i, e := range server.encoders {
+			if e.mediaType == entry.mediaType {
+				server.encoders[i] = entry
+				return
+			}
+		}
+		server.encoders = append(server.encoders, entry)
+	}
+}
+
+// Negotiate 根据 Accept 请求头选择响应的格式
+// 默认支持 JSON、XML、HTML 和纯文本，Accept 为空的时候使用 JSON
+// 没有能够满足 Accept 的格式的时候，响应 406 并且返回 ErrNotAcceptable
+func (c *Context) Negotiate(code int, data any) error {
+	encoders := c.encoders
+	if encoders == nil {
+		encoders = defaultEncoders
+	}
+	c.Resp.Header().Add("Vary", "Accept")
+	entry, ok := negotiate(c.Req.Header.Values("Accept"), encoders)
+	if !ok {
+		c.RespString(http.StatusNotAcceptable, "Not Acceptable")
+		return ErrNotAcceptable
+	}
+	bs, err := entry.encoder.Encode(data)
+	if err != nil {
+		return err
+	}
+	c.RespBytes(code, entry.contentType, bs)
+	return nil
+}
+
+type acceptItem struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate 按照 q 从高到低，同样的 q 按照出现的顺序，找到第一个支持的格式
+func negotiate(accepts []string, encoders []encoderEntry) (encoderEntry, bool) {
+	if len(encoders) == 0 {
+		return encoderEntry{}, false
+	}
+	items := parseAccept(accepts)
+	if len(items) == 0 {
+		return encoders[0], true
+	}
+	for _, item := range items {
+		for _, e := range encoders {
+			if matchMediaType(item.mediaType, e.mediaType) {
+				return e, true
+			}
+		}
+	}
+	return encoderEntry{}, false
+}
+
+func parseAccept(accepts []string) []acceptItem {
+	var items []acceptItem
+	for _, accept := range accepts {
+		for _, part := range strings.Split(accept, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if qs, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(qs, 64); err != nil {
+					continue
+				}
+			}
+			// q=0 表示明确不接受
+			if q <= 0 {
+				continue
+			}
+			items = append(items, acceptItem{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	return items
+}
+
+// matchMediaType 支持 */* 和 type/* 这种通配符
+func matchMediaType(pattern string, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if !strings.HasSuffix(pattern, "/*") {
+		return false
+	}
+	return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+}
+
+// encodeHTML template.HTML 原样输出，其它数据会被转义
+func encodeHTML(data any) ([]byte, error) {
+	switch d := data.(type) {
+	case template.HTML:
+		return []byte(d), nil
+	case []byte:
+		return []byte(html.EscapeString(string(d))), nil
+	}
+	bs, err := encodePlain(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(html.EscapeString(string(bs))), nil
+}
+
+func encodePlain(data any) ([]byte, error) {
+	switch d := data.(type) {
+	case string:
+		return []byte(d), nil
+	case []byte:
+		return d, nil
+	case fmt.Stringer:
+		return []byte(d.String()), nil
+	case error:
+		return []byte(d.Error()), nil
+	}
+	return []byte(fmt.Sprint(data)), nil
+}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"context"
 	"database/sql"
+	"github.com/coderi421/kyuu/middleware/requestid/ctxkey"
 	"github.com/coderi421/kyuu/orm"
 	"github.com/coderi421/kyuu/orm/middlewares/querylog"
 	_ "github.com/mattn/go-sqlite3"
@@ -37,6 +38,21 @@ func TestNewMiddlewareBuilder(t *testing.T) {
 	assert.Equal(t, []any{int64(18), "", int8(0), (*sql.NullString)(nil)}, args)
 }
 
+func TestMiddlewareBuilder_LogFuncContext(t *testing.T) {
+	var id string
+	m := querylog.NewMiddlewareBuilder().LogFuncContext(func(ctx context.Context, q string, as []any) {
+		id, _ = ctxkey.FromContext(ctx)
+	})
+
+	db, err := orm.Open("sqlite3",
+		"file:test.db?cache=shared&mode=memory",
+		orm.DBWithMiddlewares(m.Build()))
+	require.NoError(t, err)
+	ctx := ctxkey.NewContext(context.Background(), "abc-123")
+	_, _ = orm.NewSelector[TestModel](db).Where(orm.C("Id").EQ(10)).Get(ctx)
+	assert.Equal(t, "abc-123", id)
+}
+
 type TestModel struct {
 	Id        int64
 	FirstName string
@@ -2,24 +2,31 @@ package querylog
 
 import (
 	"context"
+	"github.com/coderi421/kyuu/middleware/requestid/ctxkey"
 	"github.com/coderi421/kyuu/orm"
 	"log"
 )
 
 type MiddlewareBuilder struct {
-	logFunc func(query string, args []any)
+	logFunc func(ctx context.Context, query string, args []any)
 	// logFunc func(query string, args...)
 }
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
 	return &MiddlewareBuilder{
-		logFunc: func(query string, args []any) {
-			log.Printf("sql: %s, args: %v", query, args)
-		},
+		logFunc: defaultLogFunc,
 	}
 }
 
 func (m *MiddlewareBuilder) LogFunc(fn func(query string, args []any)) *MiddlewareBuilder {
+	m.logFunc = func(ctx context.Context, query string, args []any) {
+		fn(query, args)
+	}
+	return m
+}
+
+// LogFuncContext 和 LogFunc 一样，但是可以拿到查询的 context，例如通过 ctxkey.FromContext 拿到请求 ID
+func (m *MiddlewareBuilder) LogFuncContext(fn func(ctx context.Context, query string, args []any)) *MiddlewareBuilder {
 	m.logFunc = fn
 	return m
 }
@@ -34,10 +41,19 @@ func (m MiddlewareBuilder) Build() orm.Middleware {
 					Err: err,
 				}
 			}
-			m.logFunc(q.SQL, q.Args)
+			m.logFunc(ctx, q.SQL, q.Args)
 			// 不调用 next 就是 dry run
 			res := next(ctx, qc)
 			return res
 		}
 	}
 }
+
+// defaultLogFunc 查询的 context 里面有请求 ID 的时候一起打印出来，方便和访问日志关联
+func defaultLogFunc(ctx context.Context, query string, args []any) {
+	if id, ok := ctxkey.FromContext(ctx); ok {
+		log.Printf("request_id: %s, sql: %s, args: %v", id, query, args)
+		return
+	}
+	log.Printf("sql: %s, args: %v", query, args)
+}
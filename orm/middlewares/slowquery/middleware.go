@@ -2,6 +2,7 @@ package querylog
 
 import (
 	"context"
+	"github.com/coderi421/kyuu/middleware/requestid/ctxkey"
 	"github.com/coderi421/kyuu/orm"
 	"log"
 	"time"
@@ -10,21 +11,27 @@ import (
 type MiddlewareBuilder struct {
 	// 慢查询阈值
 	threshold time.Duration
-	logFunc   func(query string, args []any)
+	logFunc   func(ctx context.Context, query string, args []any)
 	// logFunc func(query string, args...)
 }
 
 // 100ms
 func NewMiddlewareBuilder(threshold time.Duration) *MiddlewareBuilder {
 	return &MiddlewareBuilder{
-		logFunc: func(query string, args []any) {
-			log.Printf("sql: %s, args: %v", query, args)
-		},
+		logFunc:   defaultLogFunc,
 		threshold: threshold,
 	}
 }
 
 func (m *MiddlewareBuilder) LogFunc(fn func(query string, args []any)) *MiddlewareBuilder {
+	m.logFunc = func(ctx context.Context, query string, args []any) {
+		fn(query, args)
+	}
+	return m
+}
+
+// LogFuncContext 和 LogFunc 一样，但是可以拿到查询的 context，例如通过 ctxkey.FromContext 拿到请求 ID
+func (m *MiddlewareBuilder) LogFuncContext(fn func(ctx context.Context, query string, args []any)) *MiddlewareBuilder {
 	m.logFunc = fn
 	return m
 }
@@ -42,7 +49,7 @@ func (m MiddlewareBuilder) Build() orm.Middleware {
 				q, err := qc.Builder.Build()
 				if err == nil {
 					// 要考虑记录一下
-					m.logFunc(q.SQL, q.Args)
+					m.logFunc(ctx, q.SQL, q.Args)
 				}
 			}()
 
@@ -51,3 +58,12 @@ func (m MiddlewareBuilder) Build() orm.Middleware {
 		}
 	}
 }
+
+// defaultLogFunc 查询的 context 里面有请求 ID 的时候一起打印出来，方便和访问日志关联
+func defaultLogFunc(ctx context.Context, query string, args []any) {
+	if id, ok := ctxkey.FromContext(ctx); ok {
+		log.Printf("request_id: %s, sql: %s, args: %v", id, query, args)
+		return
+	}
+	log.Printf("sql: %s, args: %v", query, args)
+}
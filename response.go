@@ -0,0 +1,89 @@
+package kyuu
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// RespXML 将 val 序列化为 XML 作为响应
+func (c *Context) RespXML(code int, val any) error {
+	bs, err := xml.Marshal(val)
+	if err != nil {
+		return err
+	}
+	c.RespBytes(code, "application/xml; charset=utf-8", bs)
+	return nil
+}
+
+// RespString 以 text/plain 的格式返回字符串
+func (c *Context) RespString(code int, s string) {
+	c.RespBytes(code, "text/plain; charset=utf-8", []byte(s))
+}
+
+// RespBytes 返回任意格式的数据，contentType 为空的时候由 net/http 根据内容推断
+func (c *Context) RespBytes(code int, contentType string, data []byte) {
+	if contentType != "" {
+		c.Resp.Header().Set("Content-Type", contentType)
+	}
+	c.RespStatusCode = code
+	c.RespData = data
+}
+
+// Redirect 重定向到 location，code 必须是 3xx
+// 一般来说，GET 请求使用 302 或者 301，其它请求想要保留方法和请求体的时候使用 307 或者 308
+func (c *Context) Redirect(code int, location string) error {
+	if code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect {
+		return fmt.Errorf("kyuu: 非法的重定向状态码 %d", code)
+	}
+	c.Resp.Header().Set("Location", location)
+	c.RespStatusCode = code
+	c.RespData = nil
+	return nil
+}
+
+// RespFile 将文件作为响应返回，支持 Range、If-Modified-Since 等缓存相关的请求头
+// 文件不存在的时候返回 404，path 是目录的时候返回 403
+// 为了支持大文件，文件内容直接写入 Resp，不会经过 RespData
+func (c *Context) RespFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.RespString(http.StatusNotFound, "Not Found")
+		} else {
+			c.RespString(http.StatusInternalServerError, "Internal Server Error")
+		}
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.RespString(http.StatusInternalServerError, "Internal Server Error")
+		return err
+	}
+	if info.IsDir() {
+		c.RespString(http.StatusForbidden, "Forbidden")
+		return fmt.Errorf("kyuu: %s 是一个目录", path)
+	}
+
+	w := &statusWriter{ResponseWriter: c.Resp, code: http.StatusOK}
+	// Content-Type 由 ServeContent 根据后缀名或者内容推断
+	http.ServeContent(w, c.Req, filepath.Base(path), info.ModTime(), f)
+	c.fileServed = true
+	c.RespStatusCode = w.code
+	return nil
+}
+
+// statusWriter 记录直接写入 Resp 时使用的状态码，方便 accesslog 之类的中间件拿到
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,286 @@
+package kyuu
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type negotiateUser struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	Name    string   `json:"name" xml:"name"`
+}
+
+func (u negotiateUser) String() string {
+	return "user " + u.Name
+}
+
+func TestContext_Resp(t *testing.T) {
+	testCases := []struct {
+		name            string
+		handler         HandleFunc
+		wantCode        int
+		wantContentType string
+		wantLocation    string
+		wantBody        string
+	}{
+		{
+			name: "xml",
+			handler: func(ctx *Context) {
+				_ = ctx.RespXML(http.StatusCreated, negotiateUser{Name: "Tom"})
+			},
+			wantCode:        http.StatusCreated,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody:        "<user><name>Tom</name></user>",
+		},
+		{
+			name: "string",
+			handler: func(ctx *Context) {
+				ctx.RespString(http.StatusOK, "hello")
+			},
+			wantCode:        http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "hello",
+		},
+		{
+			name: "bytes",
+			handler: func(ctx *Context) {
+				ctx.RespBytes(http.StatusOK, "application/octet-stream", []byte{1, 2})
+			},
+			wantCode:        http.StatusOK,
+			wantContentType: "application/octet-stream",
+			wantBody:        "\x01\x02",
+		},
+		{
+			name: "json",
+			handler: func(ctx *Context) {
+				_ = ctx.RespJSON(http.StatusOK, negotiateUser{Name: "Tom"})
+			},
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			name: "redirect",
+			handler: func(ctx *Context) {
+				_ = ctx.Redirect(http.StatusFound, "/login")
+			},
+			wantCode:     http.StatusFound,
+			wantLocation: "/login",
+		},
+		{
+			name: "invalid redirect",
+			handler: func(ctx *Context) {
+				err := ctx.Redirect(http.StatusOK, "/login")
+				ctx.RespString(http.StatusInternalServerError, err.Error())
+			},
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "kyuu: 非法的重定向状态码 200",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer()
+			s.Get("/", tc.handler)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestContext_RespFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0o644))
+	modTime := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	s := NewHTTPServer()
+	var code int
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			code = ctx.RespStatusCode
+		}
+	})
+	s.Get("/file/:name", func(ctx *Context) {
+		_ = ctx.RespFile(filepath.Join(dir, ctx.PathParams["name"]))
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "file",
+			path:     "/file/hello.txt",
+			wantCode: http.StatusOK,
+			wantBody: "hello world",
+		},
+		{
+			name:     "range",
+			path:     "/file/hello.txt",
+			header:   http.Header{"Range": {"bytes=0-4"}},
+			wantCode: http.StatusPartialContent,
+			wantBody: "hello",
+		},
+		{
+			name:     "not modified",
+			path:     "/file/hello.txt",
+			header:   http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "not found",
+			path:     "/file/missing.txt",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantCode, code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestContext_Negotiate(t *testing.T) {
+	msgpack := EncoderFunc(func(data any) ([]byte, error) {
+		return []byte("msgpack"), nil
+	})
+	testCases := []struct {
+		name            string
+		opts            []HTTPServerOption
+		data            any
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+		wantErr         error
+	}{
+		{
+			name:            "no accept",
+			data:            negotiateUser{Name: "Tom"},
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			name:            "xml",
+			data:            negotiateUser{Name: "Tom"},
+			accept:          "application/xml",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody:        "<user><name>Tom</name></user>",
+		},
+		{
+			name:            "quality",
+			data:            negotiateUser{Name: "Tom"},
+			accept:          "application/json;q=0.5, text/plain, text/html;q=0.8",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "user Tom",
+		},
+		{
+			name:            "html escape",
+			data:            "<b>Tom</b>",
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "&lt;b&gt;Tom&lt;/b&gt;",
+		},
+		{
+			name:            "html",
+			data:            template.HTML("<b>Tom</b>"),
+			accept:          "text/*",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<b>Tom</b>",
+		},
+		{
+			name:            "wildcard",
+			data:            negotiateUser{Name: "Tom"},
+			accept:          "image/png, */*;q=0.1",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"Tom"}`,
+		},
+		{
+			name:            "not acceptable",
+			data:            negotiateUser{Name: "Tom"},
+			accept:          "image/png, application/json;q=0",
+			wantCode:        http.StatusNotAcceptable,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Not Acceptable",
+			wantErr:         ErrNotAcceptable,
+		},
+		{
+			name:            "custom encoder",
+			opts:            []HTTPServerOption{ServerWithEncoder("application/msgpack", msgpack)},
+			data:            negotiateUser{Name: "Tom"},
+			accept:          "application/msgpack",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/msgpack",
+			wantBody:        "msgpack",
+		},
+		{
+			name:            "replace encoder",
+			opts:            []HTTPServerOption{ServerWithEncoder("application/json; charset=utf-8", msgpack)},
+			data:            negotiateUser{Name: "Tom"},
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json; charset=utf-8",
+			wantBody:        "msgpack",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			var err error
+			s.Get("/", func(ctx *Context) {
+				err = ctx.Negotiate(http.StatusOK, tc.data)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func Test_negotiate_noEncoders(t *testing.T) {
+	_, ok := negotiate(nil, nil)
+	assert.False(t, ok)
+	_, ok = negotiate([]string{"application/json"}, nil)
+	assert.False(t, ok)
+}
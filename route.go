@@ -2,17 +2,36 @@ package kyuu
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type router struct {
 	trees map[string]*node
+	// 命名路由，路由名字 => 路由节点，用于反向生成 URL
+	names map[string]*node
+	// 静态路由匹配的时候忽略大小写
+	caseInsensitive bool
+	// 注册之后还没有组装 middleware 的路由树
+	pending *pendingTrees
+}
+
+// pendingTrees 记录需要重新组装 middleware 的路由树
+// 每次注册都重新计算的话，注册 n 个路由的开销是 O(n^2)，所以推迟到第一次匹配的时候统一计算
+type pendingTrees struct {
+	mutex   sync.Mutex
+	dirty   atomic.Bool
+	methods map[string]struct{}
 }
 
 func newRouter() router {
 	return router{
-		trees: map[string]*node{},
+		trees:   map[string]*node{},
+		names:   map[string]*node{},
+		pending: &pendingTrees{methods: map[string]struct{}{}},
 	}
 }
 
@@ -29,8 +48,18 @@ func newRouter() router {
 //	    @param path
 //	    @param handleFunc 路由处理函数
 func (r *router) addRoute(method string, path string, handleFunc HandleFunc, ms ...Middleware) {
+	r.addNamedRoute("", method, path, handleFunc, ms...)
+}
+
+// addNamedRoute 注册路由，同时给路由起一个名字，之后可以通过 urlFor 反向生成 URL
+// name 为空字符串的时候，等价于 addRoute
+// 路由名字不允许重复
+func (r *router) addNamedRoute(name string, method string, path string, handleFunc HandleFunc, ms ...Middleware) {
 	// validate route before add
 	r.validateRoute(path)
+	if _, ok := r.names[name]; ok && name != "" {
+		panic(fmt.Sprintf("kyuu: 路由名字冲突[%s]", name))
+	}
 
 	// 注册路由到路由树
 	root, ok := r.trees[method]
@@ -46,7 +75,10 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, ms
 			panic("kyuu: 路由冲突[/]")
 		}
 		root.handler = handleFunc
-		root.mdls = ms
+		root.route = path
+		root.mdls = append(root.mdls, ms...)
+		r.nameNode(name, root)
+		r.markDirty(method)
 		return
 	}
 
@@ -70,64 +102,306 @@ func (r *router) addRoute(method string, path string, handleFunc HandleFunc, ms
 	// 找到最后一个节点，将 handler 赋值
 	root.handler = handleFunc
 	root.route = path
-	root.mdls = ms
+	root.mdls = append(root.mdls, ms...)
+	r.nameNode(name, root)
+	r.markDirty(method)
 }
 
-func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
+func (r *router) nameNode(name string, n *node) {
+	if name != "" {
+		r.names[name] = n
+	}
+}
+
+// urlFor 根据路由名字反向生成 URL
+// params 提供路径参数的值，正则路由的值必须能够匹配上正则表达式，通配符 * 的值用 "*" 作为 key
+// query 不为空的时候，会拼接在 URL 后面
+func (r *router) urlFor(name string, params map[string]string, query url.Values) (string, error) {
+	n, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("kyuu: 找不到名为 %s 的路由", name)
+	}
+
+	var sb strings.Builder
+	if n.route == "/" {
+		sb.WriteByte('/')
+	} else {
+		for _, seg := range strings.Split(n.route[1:], "/") {
+			sb.WriteByte('/')
+			switch {
+			case seg == "*":
+				val, ok := params["*"]
+				if !ok {
+					return "", fmt.Errorf("kyuu: 路由 %s 缺少通配符 * 的值", n.route)
+				}
+				// 通配符可以匹配多段，所以每一段单独转义
+				parts := strings.Split(strings.Trim(val, "/"), "/")
+				for i, p := range parts {
+					parts[i] = url.PathEscape(p)
+				}
+				sb.WriteString(strings.Join(parts, "/"))
+			case seg[0] == ':':
+				if paramName, pt, isTyped := parseTypedParam(seg); isTyped {
+					val, ok := params[paramName]
+					if !ok || val == "" {
+						return "", fmt.Errorf("kyuu: 路由 %s 缺少路径参数 %s 的值", n.route, paramName)
+					}
+					if !pt.match(val) {
+						return "", fmt.Errorf("kyuu: 路径参数 %s 的值 %s 不是合法的 %s", paramName, val, pt.name)
+					}
+					sb.WriteString(url.PathEscape(val))
+					continue
+				}
+				paramName, expr, isReg := n.parseParam(seg)
+				val, ok := params[paramName]
+				if !ok || val == "" {
+					return "", fmt.Errorf("kyuu: 路由 %s 缺少路径参数 %s 的值", n.route, paramName)
+				}
+				if isReg {
+					matched, err := regexp.MatchString(expr, val)
+					if err != nil {
+						return "", err
+					}
+					if !matched {
+						return "", fmt.Errorf("kyuu: 路径参数 %s 的值 %s 不匹配正则表达式 %s", paramName, val, expr)
+					}
+				}
+				sb.WriteString(url.PathEscape(val))
+			default:
+				sb.WriteString(seg)
+			}
+		}
+	}
+
+	if len(query) > 0 {
+		sb.WriteByte('?')
+		sb.WriteString(query.Encode())
+	}
+	return sb.String(), nil
+}
+
+// addMiddlewares 将 middleware 挂载到 path 对应的节点上，节点不存在则创建
+// 挂载之后，所有能够匹配到该节点的请求，都会执行这些 middleware
+// 主要给路由分组使用，所以 path 的校验规则和 addRoute 保持一致
+func (r *router) addMiddlewares(method string, path string, ms ...Middleware) {
+	r.validateRoute(path)
+
 	root, ok := r.trees[method]
 	if !ok {
-		return nil, false
+		root = &node{path: "/"}
+		r.trees[method] = root
 	}
 
-	if path == "/" {
-		return &matchInfo{n: root, mdls: root.mdls}, true
+	if path != "/" {
+		for _, s := range strings.Split(path[1:], "/") {
+			if s == "" {
+				panic(fmt.Sprintf("kyuu: 非法路由。不允许使用 //a/b, /a//b 之类的路由，[%s]", path))
+			}
+			root = root.childOrCreate(s)
+		}
 	}
+	root.mdls = append(root.mdls, ms...)
+	r.markDirty(method)
+}
 
-	segments := strings.Split(strings.Trim(path, "/"), "/")
-	mi := &matchInfo{}
-	// 将 root 复制一份，不然处理后 findMdls 中的 root 就发生变化，不准
-	cur := root
-	// 分别处理每一段 /a/b/c
-	for _, s := range segments {
-		var child *node
-
-		child, ok = cur.childOf(s)
-		if !ok {
-			// 如果没有命中任何一个，而且还有上一段路由 最后一段是 通配符 *， 那么就直接返回 通配符以后的，都归这段处理
-			// /a/b/c -> 归 /a/b/*
-			if cur.typ == nodeTypeAny {
-				mi.n = cur
-				mi.mdls = r.findMdls(cur, segments)
-				return mi, true
+// markDirty 新注册的路由和 middleware 可能影响同一棵树上的其它路由，所以整棵树都要重新计算
+func (r *router) markDirty(method string) {
+	p := r.pending
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.methods[method] = struct{}{}
+	p.dirty.Store(true)
+}
+
+// build 重新计算所有注册过路由的树，没有新注册的时候只有一次原子操作的开销
+// 第一次请求可能是并发的，所以需要加锁
+func (r *router) build() {
+	p := r.pending
+	if !p.dirty.Load() {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for method := range p.methods {
+		r.rebuild(method)
+		delete(p.methods, method)
+	}
+	p.dirty.Store(false)
+}
+
+// rebuild 重新计算 method 对应的路由树上，每个节点能够命中的 middleware，并且组装好 handler
+// 路由注册发生在启动之前，所以这里用第一次匹配时候的开销换取请求时候不再遍历路由树
+func (r *router) rebuild(method string) {
+	root := r.trees[method]
+	var walk func(n *node, segs []string)
+	walk = func(n *node, segs []string) {
+		n.matchedMdls = matchedMdlsOf(root, segs)
+		n.chain = nil
+		if n.handler != nil {
+			n.chain = n.handler
+			for i := len(n.matchedMdls) - 1; i >= 0; i-- {
+				n.chain = n.matchedMdls[i](abortable(n.chain))
 			}
-			return nil, false
 		}
-		// eb
-		if child.paramName != "" {
-			mi.addValue(child.paramName, s)
+		for _, child := range n.children {
+			walk(child, append(segs, child.path))
+		}
+		for _, child := range []*node{n.regChild, n.typedChild, n.paramChild, n.starChild} {
+			if child != nil {
+				walk(child, append(segs, child.path))
+			}
 		}
-		cur = child
 	}
-	mi.n = cur
-	// 将这条路径上所有可能的 middlewares 一并返回
-	mi.mdls = r.findMdls(root, segments)
+	walk(root, make([]string, 0, 8))
+}
 
+func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
+	mi := &matchInfo{}
+	if !r.match(method, path, mi) {
+		return nil, false
+	}
 	return mi, true
 }
 
-// findMdls find the matched routers` middlewares
-func (r *router) findMdls(root *node, segs []string) []Middleware {
+// match 查找路由，结果写入 mi，找不到的时候返回 false
+// 逐段切分 path，不会像 strings.Split 那样分配切片，mi 也可以由调用者复用
+func (r *router) match(method string, path string, mi *matchInfo) bool {
+	r.build()
+	root, ok := r.trees[method]
+	if !ok {
+		return false
+	}
+
+	if path == "/" {
+		mi.n = root
+		mi.mdls = root.matchedMdls
+		return true
+	}
+
+	segments := strings.Trim(path, "/")
+	// 优先找有 handler 的节点，找不到的时候退而求其次，返回第一个能够匹配上的节点
+	// 这样像 /a/b 只是 /a/b/c 的中间节点的时候，/a/b 依旧可以命中 /a/:id
+	opt := matchOption{withHandler: true, caseInsensitive: r.caseInsensitive}
+	n := root.match(segments, opt, mi)
+	if n == nil {
+		opt.withHandler = false
+		n = root.match(segments, opt, mi)
+	}
+	if n == nil {
+		return false
+	}
+	mi.n = n
+	// 将这条路径上所有可能的 middlewares 一并返回，注册路由的时候已经算好了
+	mi.mdls = n.matchedMdls
+
+	return true
+}
+
+// match 在 n 的子树里面查找能够匹配 path 的节点，path 是去掉了首尾 / 的剩余路径
+// 按照 静态、正则、类型参数、路径参数、通配符 的优先级尝试每个子节点，
+// 某个子节点后面的路径匹配不上的时候，会回溯尝试下一个优先级的子节点
+// 例如注册了 /a/b/c 和 /a/:id/d，那么 /a/b/d 会命中 /a/:id/d
+// 所有子节点都匹配不上的时候，如果 n 是通配符节点，那么剩余的路径都归 n 处理
+func (n *node) match(path string, opt matchOption, mi *matchInfo) *node {
+	seg, rest, more := strings.Cut(path, "/")
+	child, ok := n.children[seg]
+	if !ok && opt.caseInsensitive {
+		child, ok = n.childFold(seg)
+	}
+	if ok {
+		if res := child.matchRest(seg, rest, more, opt, mi); res != nil {
+			return res
+		}
+	}
+	if n.regChild != nil && n.regChild.regExpr.MatchString(seg) {
+		if res := n.regChild.matchRest(seg, rest, more, opt, mi); res != nil {
+			return res
+		}
+	}
+	if n.typedChild != nil && n.typedChild.paramType.match(seg) {
+		if res := n.typedChild.matchRest(seg, rest, more, opt, mi); res != nil {
+			return res
+		}
+	}
+	if n.paramChild != nil {
+		if res := n.paramChild.matchRest(seg, rest, more, opt, mi); res != nil {
+			return res
+		}
+	}
+	if n.starChild != nil {
+		if res := n.starChild.matchRest(seg, rest, more, opt, mi); res != nil {
+			return res
+		}
+	}
+	// 如果没有命中任何一个，而且上一段路由是 通配符 *， 那么就直接返回 通配符以后的，都归这段处理
+	// /a/b/c -> 归 /a/b/*
+	if n.typ == nodeTypeAny && (!opt.withHandler || n.handler != nil) {
+		return n
+	}
+	return nil
+}
+
+type matchOption struct {
+	// 为 true 的时候，只有带有 handler 的节点才算匹配上
+	withHandler bool
+	// 静态路由忽略大小写
+	caseInsensitive bool
+}
+
+// childFold 忽略大小写查找静态子节点，只在精确查找失败的时候使用
+func (n *node) childFold(seg string) (*node, bool) {
+	for path, child := range n.children {
+		if strings.EqualFold(path, seg) {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// matchRest n 已经匹配上了 seg，继续匹配剩余的路径
+// 整条路径匹配成功之后才记录路径参数，所以回溯的时候不需要清理
+func (n *node) matchRest(seg string, rest string, more bool, opt matchOption, mi *matchInfo) *node {
+	var res *node
+	if more {
+		res = n.match(rest, opt, mi)
+	} else if !opt.withHandler || n.handler != nil {
+		res = n
+	}
+	if res != nil && n.paramName != "" {
+		// 从深往浅记录，同名的路径参数以后面的为准
+		if _, ok := mi.pathParams[n.paramName]; !ok {
+			mi.addValue(n.paramName, seg)
+			if n.typ == nodeTypeTyped {
+				// 前面已经用 paramType.match 校验过了，转换不会失败
+				if val, err := n.paramType.convert(seg); err == nil {
+					mi.addTypedValue(n.paramName, val)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// matchedMdlsOf 找到路由 segs 能够命中的所有 middleware
+// 按照层级从浅到深，同一层按照 通配符、路径参数、正则、静态 的顺序
+// 例如注册了 /a/*、/a/b 和 /a/b/c 的 middleware，那么 /a/b/c 会依次执行 /a/*、/a/b、/a/b/c 上的 middleware
+// segs 里面的路径参数、正则和通配符，在请求的时候可以是任意值，
+// 所以只会命中其它分支上同样能够匹配任意值的节点，也就是通配符、路径参数以及同样的正则
+func matchedMdlsOf(root *node, segs []string) []Middleware {
 	queue := []*node{root}
-	res := make([]Middleware, 0, 16)
-	for i := 0; i < len(segs); i++ {
-		seg := segs[i]
+	var res []Middleware
+	for _, seg := range segs {
 		var children []*node
 		for _, cur := range queue {
 			if len(cur.mdls) > 0 {
 				res = append(res, cur.mdls...)
 			}
 			// 这里将下一层的所有可能的 子节点都找到
-			children = append(children, cur.childrenOf(seg)...)
+			if isStaticSegment(seg) {
+				children = append(children, cur.childrenOf(seg)...)
+			} else {
+				children = append(children, cur.dynamicChildrenOf(seg)...)
+			}
 		}
 		// 当遍历下一段路由的时候， 将上一段收集的所有子节点赋值给队列
 		queue = children
@@ -143,6 +417,10 @@ func (r *router) findMdls(root *node, segs []string) []Middleware {
 	return res
 }
 
+func isStaticSegment(seg string) bool {
+	return seg != "*" && (seg == "" || seg[0] != ':')
+}
+
 // validateRoute
 //
 //	@Description:
@@ -171,15 +449,17 @@ const (
 	nodeTypeParam
 	// 通配符路由
 	nodeTypeAny
+	// 类型参数路由，形式 :param_name<type>
+	nodeTypeTyped
 )
 
 // node 代表路由树的节点
 // 路由树的匹配顺序是：
 // 1. 静态完全匹配
 // 2. 正则匹配，形式 :param_name(reg_expr)
-// 3. 路径参数匹配：形式 :param_name
+// 3. 路径参数匹配：形式 :param_name，或者类型参数匹配：形式 :param_name<type>，例如 :id<int>
 // 4. 通配符匹配：*
-// 这是不回溯匹配
+// 某个分支后面的路径匹配不上的时候，会回溯尝试下一个优先级的分支
 type node struct {
 	typ nodeType
 
@@ -205,49 +485,15 @@ type node struct {
 	regChild *node
 	regExpr  *regexp.Regexp
 
+	// 类型参数，支持的类型见 paramTypes
+	typedChild *node
+	paramType  *paramType
+
 	// 这个地方可能在注册路由的时候，可以为每个节点，直接注册好路由，就不用每次都找一遍了
 	// 用空间换时间
 	matchedMdls []Middleware
-}
-
-// childOf find the child node by path
-//
-//	@Description:
-//	@receiver n
-//	@param path
-//	@return child *node 是命中的节点
-//	@return found bool 代表是否命中
-func (n *node) childOf(path string) (*node, bool) {
-	// 如果 children 为空，则直接返回 防止 nil pointer
-	if n.children == nil {
-		return n.childOfNonStatic(path)
-	}
-	// 优先配置 静态路由
-	child, ok := n.children[path]
-	if !ok {
-		return n.childOfNonStatic(path)
-	}
-	return child, ok
-}
-
-// childOfNonStatic
-// 从非静态匹配的子节点里面查找 reg > param > star
-//
-//	@Description:
-//	@receiver n
-//	@param path
-//	@return child *node 是命中的节点
-//	@return found bool 代表是否命中
-func (n *node) childOfNonStatic(path string) (*node, bool) {
-	if n.regChild != nil {
-		if n.regChild.regExpr.Match([]byte(path)) {
-			return n.regChild, true
-		}
-	}
-	if n.paramChild != nil {
-		return n.paramChild, true
-	}
-	return n.starChild, n.starChild != nil
+	// 组装好了 matchedMdls 的 handler
+	chain HandleFunc
 }
 
 // find the child node by path or create a new node
@@ -265,6 +511,9 @@ func (n *node) childOrCreate(path string) *node {
 		if n.regChild != nil {
 			panic(fmt.Sprintf("kyuu: 非法路由，已有正则路由。不允许同时注册通配符路由和正则路由 [%s]", path))
 		}
+		if n.typedChild != nil {
+			panic(fmt.Sprintf("kyuu: 非法路由，已有类型参数路由。不允许同时注册通配符路由和类型参数路由 [%s]", path))
+		}
 		if n.starChild == nil {
 			n.starChild = &node{path: path, typ: nodeTypeAny}
 		}
@@ -273,6 +522,9 @@ func (n *node) childOrCreate(path string) *node {
 
 	// 以 : 开头，需要进一步解析，判断是参数路由还是正则路由，这里是二进制的符号
 	if path[0] == ':' {
+		if paramName, pt, ok := parseTypedParam(path); ok {
+			return n.childOrCreateTyped(path, pt, paramName)
+		}
 		paramName, expr, isReg := n.parseParam(path)
 		if isReg {
 			return n.childOrCreateReg(path, expr, paramName)
@@ -303,6 +555,9 @@ func (n *node) childOrCreateReg(path string, expr string, paramName string) *nod
 	if n.paramChild != nil {
 		panic(fmt.Sprintf("kyuu: 非法路由，已有路径参数路由。不允许同时注册正则路由和参数路由 [%s]", path))
 	}
+	if n.typedChild != nil {
+		panic(fmt.Sprintf("kyuu: 非法路由，已有类型参数路由。不允许同时注册正则路由和类型参数路由 [%s]", path))
+	}
 	if n.regChild != nil {
 		if n.regChild.regExpr.String() != expr || n.paramName != paramName {
 			panic(fmt.Sprintf("kyuu: 路由冲突，正则路由冲突，已有 %s，新注册 %s", n.regChild.path, path))
@@ -324,6 +579,9 @@ func (n *node) childOrCreateParam(path string, paramName string) *node {
 	if n.starChild != nil {
 		panic(fmt.Sprintf("kyuu: 非法路由，已有通配符路由。不允许同时注册通配符路由和参数路由 [%s]", path))
 	}
+	if n.typedChild != nil {
+		panic(fmt.Sprintf("kyuu: 非法路由，已有类型参数路由。不允许同时注册类型参数路由和参数路由 [%s]", path))
+	}
 	if n.paramChild != nil {
 		if n.paramChild.path != path {
 			panic(fmt.Sprintf("kyuu: 路由冲突，参数路由冲突，已有 %s，新注册 %s", n.paramChild.path, path))
@@ -335,6 +593,26 @@ func (n *node) childOrCreateParam(path string, paramName string) *node {
 	return n.paramChild
 }
 
+func (n *node) childOrCreateTyped(path string, pt *paramType, paramName string) *node {
+	if n.starChild != nil {
+		panic(fmt.Sprintf("kyuu: 非法路由，已有通配符路由。不允许同时注册通配符路由和类型参数路由 [%s]", path))
+	}
+	if n.paramChild != nil {
+		panic(fmt.Sprintf("kyuu: 非法路由，已有路径参数路由。不允许同时注册类型参数路由和参数路由 [%s]", path))
+	}
+	if n.regChild != nil {
+		panic(fmt.Sprintf("kyuu: 非法路由，已有正则路由。不允许同时注册正则路由和类型参数路由 [%s]", path))
+	}
+	if n.typedChild != nil {
+		if n.typedChild.path != path {
+			panic(fmt.Sprintf("kyuu: 路由冲突，类型参数路由冲突，已有 %s，新注册 %s", n.typedChild.path, path))
+		}
+		return n.typedChild
+	}
+	n.typedChild = &node{path: path, paramName: paramName, paramType: pt, typ: nodeTypeTyped}
+	return n.typedChild
+}
+
 // parseParam
 //
 //	@Description:
@@ -369,9 +647,12 @@ func (n *node) childrenOf(path string) []*node {
 	if n.paramChild != nil {
 		res = append(res, n.paramChild)
 	}
-	if n.regChild != nil && n.regChild.regExpr.Match([]byte(path)) {
+	if n.regChild != nil && n.regChild.regExpr.MatchString(path) {
 		res = append(res, n.regChild)
 	}
+	if n.typedChild != nil && n.typedChild.paramType.match(path) {
+		res = append(res, n.typedChild)
+	}
 	if n.children != nil {
 		if static, ok := n.children[path]; ok {
 			res = append(res, static)
@@ -380,11 +661,33 @@ func (n *node) childrenOf(path string) []*node {
 	return res
 }
 
+// dynamicChildrenOf 找到能够匹配 seg 的子节点，seg 是路径参数、正则或者通配符
+func (n *node) dynamicChildrenOf(seg string) []*node {
+	res := make([]*node, 0, 2)
+	if n.starChild != nil {
+		res = append(res, n.starChild)
+	}
+	if n.paramChild != nil {
+		res = append(res, n.paramChild)
+	}
+	if n.regChild != nil && n.regChild.path == seg {
+		res = append(res, n.regChild)
+	}
+	if n.typedChild != nil && n.typedChild.path == seg {
+		res = append(res, n.typedChild)
+	}
+	return res
+}
+
 // 方便收集路径参数
 type matchInfo struct {
 	n          *node
 	pathParams map[string]string
 	mdls       []Middleware
+	// 域名里面的参数，例如 :tenant.example.com
+	hostParams map[string]string
+	// 类型参数转换之后的值，例如 :id<int> 是 int64
+	typedParams map[string]any
 }
 
 func (m *matchInfo) addValue(key, value string) {
@@ -394,6 +697,49 @@ func (m *matchInfo) addValue(key, value string) {
 	m.pathParams[key] = value
 }
 
+func (m *matchInfo) addTypedValue(key string, value any) {
+	if m.typedParams == nil {
+		m.typedParams = map[string]any{key: value}
+	}
+	m.typedParams[key] = value
+}
+
+func (m *matchInfo) addHostValue(key, value string) {
+	if m.hostParams == nil {
+		m.hostParams = map[string]string{key: value}
+	}
+	m.hostParams[key] = value
+}
+
+// mergeHostParams 将域名参数合并到路径参数里面，同名的时候以路径参数为准
+func (m *matchInfo) mergeHostParams() {
+	for k, v := range m.hostParams {
+		if _, ok := m.pathParams[k]; !ok {
+			m.addValue(k, v)
+		}
+	}
+}
+
+// reset 清空匹配结果，保留 pathParams 和 hostParams 的空间以便复用
+func (m *matchInfo) reset() {
+	m.resetRoute()
+	for k := range m.hostParams {
+		delete(m.hostParams, k)
+	}
+}
+
+// resetRoute 只清空路由的匹配结果，域名的匹配结果保持不变
+func (m *matchInfo) resetRoute() {
+	for k := range m.pathParams {
+		delete(m.pathParams, k)
+	}
+	for k := range m.typedParams {
+		delete(m.typedParams, k)
+	}
+	m.n = nil
+	m.mdls = nil
+}
+
 // type Node interface {
 // 如何匹配的问题
 // 在我的 web 小课
@@ -0,0 +1,162 @@
+package kyuu
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+)
+
+// paramType 类型参数路由支持的类型，例如 :id<int>
+// 匹配的时候不使用正则表达式
+type paramType struct {
+	name string
+	// match 判断路径中的值是否符合类型
+	match func(val string) bool
+	// convert 将路径中的值转换为对应的 Go 类型
+	convert func(val string) (any, error)
+}
+
+var paramTypes = map[string]*paramType{
+	"int": {
+		name: "int",
+		match: func(val string) bool {
+			if !isDigits(strings.TrimPrefix(val, "-")) {
+				return false
+			}
+			// 溢出也认为不匹配
+			_, err := strconv.ParseInt(val, 10, 64)
+			return err == nil
+		},
+		convert: func(val string) (any, error) {
+			return strconv.ParseInt(val, 10, 64)
+		},
+	},
+	"uint": {
+		name: "uint",
+		match: func(val string) bool {
+			if !isDigits(val) {
+				return false
+			}
+			_, err := strconv.ParseUint(val, 10, 64)
+			return err == nil
+		},
+		convert: func(val string) (any, error) {
+			return strconv.ParseUint(val, 10, 64)
+		},
+	},
+	"alpha": {
+		name:    "alpha",
+		match:   isAlpha,
+		convert: convertString,
+	},
+	"alphanum": {
+		name:    "alphanum",
+		match:   isAlphanum,
+		convert: convertString,
+	},
+	"uuid": {
+		name:  "uuid",
+		match: isUUID,
+		convert: func(val string) (any, error) {
+			return uuid.Parse(val)
+		},
+	},
+}
+
+// parseTypedParam 解析 :name<type> 形式的类型参数
+// 返回 false 代表 path 不是类型参数，类型不存在的时候会 panic
+func parseTypedParam(path string) (string, *paramType, bool) {
+	if !strings.HasSuffix(path, ">") {
+		return "", nil, false
+	}
+	name, typ, ok := strings.Cut(path[1:len(path)-1], "<")
+	if !ok {
+		return "", nil, false
+	}
+	pt, ok := paramTypes[typ]
+	if !ok {
+		panic(fmt.Sprintf("kyuu: 未知的路径参数类型 %s [%s]", typ, path))
+	}
+	return name, pt, true
+}
+
+func convertString(val string) (any, error) {
+	return val, nil
+}
+
+func isDigits(val string) bool {
+	if val == "" {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		if val[i] < '0' || val[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(val string) bool {
+	if val == "" {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		if !isLetter(val[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanum(val string) bool {
+	if val == "" {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		if !isLetter(val[i]) && (val[i] < '0' || val[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// isUUID 只支持 xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx 这种标准格式
+func isUUID(val string) bool {
+	if len(val) != 36 {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if val[i] != '-' {
+				return false
+			}
+		default:
+			c := val[i]
+			if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TypedPathValue 返回类型参数转换之后的值
+// :id<int> 返回 int64，:id<uint> 返回 uint64，:id<uuid> 返回 uuid.UUID，
+// :name<alpha> 和 :name<alphanum> 以及普通的路径参数返回 string
+// 转换是在路由匹配的时候完成的，这里只是查找
+func (c *Context) TypedPathValue(key string) (any, error) {
+	val, ok := c.PathParams[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if typed, ok := c.typedParams[key]; ok {
+		return typed, nil
+	}
+	return val, nil
+}
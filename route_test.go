@@ -1,9 +1,14 @@
 package kyuu
 
 import (
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 )
@@ -339,6 +344,14 @@ func (n *node) equal(y *node) (string, bool) {
 		}
 	}
 
+	// 如果类型参数节点存在
+	if n.typedChild != nil {
+		str, ok := n.typedChild.equal(y.typedChild)
+		if !ok {
+			return fmt.Sprintf("%s 类型参数节点不匹配 %s", n.path, str), false
+		}
+	}
+
 	// 循环遍历 子节点 判断是否相等
 	for k, v := range n.children {
 		yv, ok := y.children[k]
@@ -478,6 +491,73 @@ func Test_router_findRoute(t *testing.T) {
 		})
 	}
 }
+
+// Test_router_backtracking 匹配的优先级是 静态 > 正则 > 类型参数 > 路径参数 > 通配符
+// 优先级高的分支后面匹配不上的时候，会回溯尝试优先级低的分支
+func Test_router_backtracking(t *testing.T) {
+	r := newRouter()
+	for _, path := range []string{
+		"/a/b/c",
+		"/a/:id/d",
+		"/a/:id/c",
+		"/m/n/o",
+		"/m/:id",
+		"/s/:id(^[0-9]+$)/edit",
+		"/s/new/*",
+		"/w/*",
+		"/w/x/:id/y",
+		"/t/:id<int>/detail",
+		"/t/latest/:name",
+		"/dup/:id/abc/:id",
+		"/only/mid/x",
+	} {
+		path := path
+		r.addRoute(http.MethodGet, path, func(ctx *Context) {
+			ctx.MatchedRoute = path
+		})
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		found     bool
+		wantRoute string
+		wantParam map[string]string
+	}{
+		{name: "static first", path: "/a/b/c", found: true, wantRoute: "/a/b/c"},
+		{name: "static to param", path: "/a/b/d", found: true, wantRoute: "/a/:id/d", wantParam: map[string]string{"id": "b"}},
+		{name: "param", path: "/a/x/c", found: true, wantRoute: "/a/:id/c", wantParam: map[string]string{"id": "x"}},
+		{name: "static without handler", path: "/m/n", found: true, wantRoute: "/m/:id", wantParam: map[string]string{"id": "n"}},
+		{name: "regex", path: "/s/123/edit", found: true, wantRoute: "/s/:id(^[0-9]+$)/edit", wantParam: map[string]string{"id": "123"}},
+		{name: "static to wildcard", path: "/s/new/edit", found: true, wantRoute: "/s/new/*"},
+		{name: "regex not match", path: "/s/abc/edit"},
+		{name: "back to ancestor wildcard", path: "/w/x/1/z", found: true, wantRoute: "/w/*"},
+		{name: "param under static", path: "/w/x/1/y", found: true, wantRoute: "/w/x/:id/y", wantParam: map[string]string{"id": "1"}},
+		{name: "typed", path: "/t/1/detail", found: true, wantRoute: "/t/:id<int>/detail", wantParam: map[string]string{"id": "1"}},
+		{name: "typed not match", path: "/t/latest/go", found: true, wantRoute: "/t/latest/:name", wantParam: map[string]string{"name": "go"}},
+		{name: "same param name", path: "/dup/123/abc/456", found: true, wantRoute: "/dup/:id/abc/:id", wantParam: map[string]string{"id": "456"}},
+		{name: "no handler", path: "/only/mid", found: true},
+		{name: "not found", path: "/only/mid/y"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, found := r.findRoute(http.MethodGet, tc.path)
+			assert.Equal(t, tc.found, found)
+			if !found {
+				return
+			}
+			assert.Equal(t, tc.wantParam, mi.pathParams)
+			if tc.wantRoute == "" {
+				assert.Nil(t, mi.n.handler)
+				return
+			}
+			ctx := &Context{}
+			mi.n.handler(ctx)
+			assert.Equal(t, tc.wantRoute, ctx.MatchedRoute)
+		})
+	}
+}
+
 func Test_findRoute_Middleware(t *testing.T) {
 	var mdlBuilder = func(i byte) Middleware {
 		return func(next HandleFunc) HandleFunc {
@@ -606,3 +686,343 @@ func Test_findRoute_Middleware(t *testing.T) {
 	}
 
 }
+
+func Test_router_matchedMdls(t *testing.T) {
+	var mdlBuilder = func(i byte) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.RespData = append(ctx.RespData, i)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(ctx *Context) {
+		ctx.RespData = append(ctx.RespData, '!')
+	}
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/a/b/c", handler, mdlBuilder('c'))
+	r.addRoute(http.MethodGet, "/a/:id/d", handler, mdlBuilder('d'))
+	r.addRoute(http.MethodGet, "/a/b/:id(^[0-9]+$)", handler, mdlBuilder('r'))
+	r.addRoute(http.MethodGet, "/files/*", handler, mdlBuilder('f'))
+	// 在注册路由之后注册的 middleware 依旧会生效
+	r.addMiddlewares(http.MethodGet, "/", mdlBuilder('/'))
+	r.addMiddlewares(http.MethodGet, "/a", mdlBuilder('a'))
+	r.addMiddlewares(http.MethodGet, "/a/b", mdlBuilder('b'))
+	r.addMiddlewares(http.MethodGet, "/a/:id", mdlBuilder(':'))
+	r.addMiddlewares(http.MethodGet, "/files", mdlBuilder('F'))
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantResp string
+	}{
+		{
+			// 静态路由也会命中同一层的路径参数
+			name:     "static",
+			path:     "/a/b/c",
+			wantResp: "/a:bc!",
+		},
+		{
+			// /a/b 是静态的，所以不会命中
+			name:     "param",
+			path:     "/a/123/d",
+			wantResp: "/a:d!",
+		},
+		{
+			name:     "regex",
+			path:     "/a/b/123",
+			wantResp: "/a:br!",
+		},
+		{
+			name:     "wildcard",
+			path:     "/files/js",
+			wantResp: "/Ff!",
+		},
+		{
+			// 通配符匹配多段的时候，也会执行上层的 middleware
+			name:     "wildcard overflow",
+			path:     "/files/js/app.js",
+			wantResp: "/Ff!",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, ok := r.findRoute(http.MethodGet, tc.path)
+			if !assert.True(t, ok) {
+				return
+			}
+			ctx := &Context{}
+			mi.n.chain(ctx)
+			assert.Equal(t, tc.wantResp, string(ctx.RespData))
+
+			// 和 mdls 组装出来的结果一致
+			ctx = &Context{}
+			root := mi.n.handler
+			for i := len(mi.mdls) - 1; i >= 0; i-- {
+				root = mi.mdls[i](root)
+			}
+			root(ctx)
+			assert.Equal(t, tc.wantResp, string(ctx.RespData))
+		})
+	}
+}
+
+func Test_router_rebuildAfterMatch(t *testing.T) {
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/a/b", func(ctx *Context) {
+		ctx.RespData = append(ctx.RespData, '!')
+	})
+	mi, ok := r.findRoute(http.MethodGet, "/a/b")
+	require.True(t, ok)
+	assert.Len(t, mi.mdls, 0)
+
+	// 匹配过之后再注册的 middleware，下一次匹配的时候重新组装
+	r.addMiddlewares(http.MethodGet, "/a", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.RespData = append(ctx.RespData, 'a')
+			next(ctx)
+		}
+	})
+	mi, ok = r.findRoute(http.MethodGet, "/a/b")
+	require.True(t, ok)
+	ctx := &Context{}
+	mi.n.chain(ctx)
+	assert.Equal(t, "a!", string(ctx.RespData))
+}
+
+func Benchmark_router_addRoute(b *testing.B) {
+	handler := func(ctx *Context) {}
+	mdl := func(next HandleFunc) HandleFunc { return next }
+	for i := 0; i < b.N; i++ {
+		r := newRouter()
+		for j := 0; j < 2000; j++ {
+			r.addRoute(http.MethodGet, fmt.Sprintf("/api/v%d/user/%d/:id", j%10, j), handler, mdl)
+			r.addMiddlewares(http.MethodGet, fmt.Sprintf("/api/v%d", j%10), mdl)
+		}
+		r.findRoute(http.MethodGet, "/api/v1/user/1/123")
+	}
+}
+
+func Test_router_typedParam(t *testing.T) {
+	mockHandler := func(ctx *Context) {}
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user/:id<int>", mockHandler)
+	r.addRoute(http.MethodGet, "/user/:id<int>/detail", mockHandler)
+	r.addRoute(http.MethodGet, "/user/home", mockHandler)
+	r.addRoute(http.MethodGet, "/tag/:name<alpha>", mockHandler)
+	r.addRoute(http.MethodGet, "/code/:code<alphanum>", mockHandler)
+	r.addRoute(http.MethodGet, "/order/:sn<uuid>", mockHandler)
+	r.addRoute(http.MethodGet, "/page/:num<uint>", mockHandler)
+
+	testCases := []struct {
+		name      string
+		path      string
+		found     bool
+		wantRoute string
+		wantParam map[string]string
+	}{
+		{name: "int", path: "/user/123", found: true, wantRoute: "/user/:id<int>", wantParam: map[string]string{"id": "123"}},
+		{name: "negative int", path: "/user/-1/detail", found: true, wantRoute: "/user/:id<int>/detail", wantParam: map[string]string{"id": "-1"}},
+		{name: "static first", path: "/user/home", found: true, wantRoute: "/user/home"},
+		{name: "not int", path: "/user/abc"},
+		{name: "int overflow", path: "/user/99999999999999999999"},
+		{name: "alpha", path: "/tag/golang", found: true, wantRoute: "/tag/:name<alpha>", wantParam: map[string]string{"name": "golang"}},
+		{name: "not alpha", path: "/tag/go1"},
+		{name: "alphanum", path: "/code/go1", found: true, wantRoute: "/code/:code<alphanum>", wantParam: map[string]string{"code": "go1"}},
+		{name: "not alphanum", path: "/code/go-1"},
+		{
+			name:      "uuid",
+			path:      "/order/0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11",
+			found:     true,
+			wantRoute: "/order/:sn<uuid>",
+			wantParam: map[string]string{"sn": "0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11"},
+		},
+		{name: "not uuid", path: "/order/0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c1x"},
+		{name: "uint", path: "/page/1", found: true, wantRoute: "/page/:num<uint>", wantParam: map[string]string{"num": "1"}},
+		{name: "not uint", path: "/page/-1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, found := r.findRoute(http.MethodGet, tc.path)
+			assert.Equal(t, tc.found, found)
+			if !found {
+				return
+			}
+			assert.Equal(t, tc.wantRoute, mi.n.route)
+			assert.Equal(t, tc.wantParam, mi.pathParams)
+		})
+	}
+
+	conflicts := []struct {
+		name      string
+		paths     []string
+		wantPanic string
+	}{
+		{
+			name:      "param then typed",
+			paths:     []string{"/a/:id", "/a/:id<int>"},
+			wantPanic: "kyuu: 非法路由，已有路径参数路由。不允许同时注册类型参数路由和参数路由 [:id<int>]",
+		},
+		{
+			name:      "typed then param",
+			paths:     []string{"/a/:id<int>", "/a/:id"},
+			wantPanic: "kyuu: 非法路由，已有类型参数路由。不允许同时注册类型参数路由和参数路由 [:id]",
+		},
+		{
+			name:      "reg then typed",
+			paths:     []string{"/a/:id(^[0-9]+$)", "/a/:id<int>"},
+			wantPanic: "kyuu: 非法路由，已有正则路由。不允许同时注册正则路由和类型参数路由 [:id<int>]",
+		},
+		{
+			name:      "typed then reg",
+			paths:     []string{"/a/:id<int>", "/a/:id(^[0-9]+$)"},
+			wantPanic: "kyuu: 非法路由，已有类型参数路由。不允许同时注册正则路由和类型参数路由 [:id(^[0-9]+$)]",
+		},
+		{
+			name:      "typed then star",
+			paths:     []string{"/a/:id<int>", "/a/*"},
+			wantPanic: "kyuu: 非法路由，已有类型参数路由。不允许同时注册通配符路由和类型参数路由 [*]",
+		},
+		{
+			name:      "different type",
+			paths:     []string{"/a/:id<int>", "/a/:id<uuid>/b"},
+			wantPanic: "kyuu: 路由冲突，类型参数路由冲突，已有 :id<int>，新注册 :id<uuid>",
+		},
+		{
+			name:      "unknown type",
+			paths:     []string{"/a/:id<float>"},
+			wantPanic: "kyuu: 未知的路径参数类型 float [:id<float>]",
+		},
+	}
+	for _, tc := range conflicts {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRouter()
+			assert.PanicsWithValue(t, tc.wantPanic, func() {
+				for _, path := range tc.paths {
+					r.addRoute(http.MethodGet, path, mockHandler)
+				}
+			})
+		})
+	}
+}
+
+func TestContext_TypedPathValue(t *testing.T) {
+	s := NewHTTPServer()
+	var vals []any
+	s.Get("/user/:id<int>/order/:sn<uuid>/:name", func(ctx *Context) {
+		for _, key := range []string{"id", "sn", "name"} {
+			val, err := ctx.TypedPathValue(key)
+			require.NoError(t, err)
+			vals = append(vals, val)
+		}
+		_, err := ctx.TypedPathValue("missing")
+		assert.Equal(t, ErrKeyNotFound, err)
+		// 转换的结果保存在 Context 上，复制出来的 Context 也能拿到
+		val, err := ctx.Clone().TypedPathValue("id")
+		require.NoError(t, err)
+		assert.Equal(t, int64(123), val)
+	})
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet,
+		"/user/123/order/0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11/tom", nil))
+	assert.Equal(t, []any{int64(123), uuid.MustParse("0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11"), "tom"}, vals)
+
+	s.NamedRoute("user", http.MethodGet, "/user/:id<int>", func(ctx *Context) {})
+	_, err := s.URLFor("user", map[string]string{"id": "abc"}, nil)
+	assert.EqualError(t, err, "kyuu: 路径参数 id 的值 abc 不是合法的 int")
+	path, err := s.URLFor("user", map[string]string{"id": "12"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/user/12", path)
+}
+
+func Test_router_urlFor(t *testing.T) {
+	mockHandler := func(ctx *Context) {}
+	r := newRouter()
+	r.addNamedRoute("home", http.MethodGet, "/", mockHandler)
+	r.addNamedRoute("user", http.MethodGet, "/user/:id", mockHandler)
+	r.addNamedRoute("order", http.MethodPost, "/order/:id(^[0-9]+$)/detail", mockHandler)
+	r.addNamedRoute("static", http.MethodGet, "/static/*", mockHandler)
+	r.addRoute(http.MethodGet, "/anonymous", mockHandler)
+
+	testCases := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		query   url.Values
+		wantURL string
+		wantErr error
+	}{
+		{
+			name:    "root",
+			route:   "home",
+			wantURL: "/",
+		},
+		{
+			name:    "param",
+			route:   "user",
+			params:  map[string]string{"id": "123"},
+			wantURL: "/user/123",
+		},
+		{
+			name:    "param escape",
+			route:   "user",
+			params:  map[string]string{"id": "a b/c"},
+			wantURL: "/user/a%20b%2Fc",
+		},
+		{
+			name:    "query",
+			route:   "user",
+			params:  map[string]string{"id": "123"},
+			query:   url.Values{"tab": {"home"}, "page": {"1"}},
+			wantURL: "/user/123?page=1&tab=home",
+		},
+		{
+			name:    "missing param",
+			route:   "user",
+			wantErr: errors.New("kyuu: 路由 /user/:id 缺少路径参数 id 的值"),
+		},
+		{
+			name:    "regexp",
+			route:   "order",
+			params:  map[string]string{"id": "123"},
+			wantURL: "/order/123/detail",
+		},
+		{
+			name:    "regexp not match",
+			route:   "order",
+			params:  map[string]string{"id": "abc"},
+			wantErr: errors.New("kyuu: 路径参数 id 的值 abc 不匹配正则表达式 ^[0-9]+$"),
+		},
+		{
+			name:    "star",
+			route:   "static",
+			params:  map[string]string{"*": "js/app.js"},
+			wantURL: "/static/js/app.js",
+		},
+		{
+			name:    "missing star",
+			route:   "static",
+			wantErr: errors.New("kyuu: 路由 /static/* 缺少通配符 * 的值"),
+		},
+		{
+			name:    "unknown",
+			route:   "anonymous",
+			wantErr: errors.New("kyuu: 找不到名为 anonymous 的路由"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := r.urlFor(tc.route, tc.params, tc.query)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantURL, res)
+		})
+	}
+
+	assert.PanicsWithValue(t, "kyuu: 路由名字冲突[user]", func() {
+		r.addNamedRoute("user", http.MethodPost, "/user/:id", mockHandler)
+	})
+}
@@ -1,13 +1,24 @@
 package kyuu
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type HandleFunc func(ctx *Context)
 
+// Hook 生命周期回调，例如在启动的时候注册服务，在关闭的时候关闭 orm.DB 或者 session 的 Store
+// ctx 在 Shutdown 的时候会带上超时时间，Hook 应该尊重这个超时时间
+type Hook func(ctx context.Context) error
+
 // 确保 HTTPServer 肯定实现了 Server 接口
 var _ Server = (*HTTPServer)(nil)
 
@@ -25,6 +36,9 @@ type Server interface {
 	// 或者 "localhost:8082"
 	Start(addr string) error
 
+	// Shutdown 优雅退出，等待已有请求处理完毕，并且执行关闭回调
+	Shutdown(ctx context.Context) error
+
 	// AddRoute add the route to the server.
 	// AddRoute 路由注册功能
 	// method 是 HTTP 方法
@@ -43,17 +57,56 @@ type HTTPServer struct {
 	router
 	mdls      []Middleware
 	tplEngine TemplateEngine
+	validator Validator
+	// 将 error 转换为响应，为 nil 的时候使用 DefaultErrorHandler
+	errHandler ErrorHandler
+	// 内容协商可以使用的格式，按照注册的顺序匹配
+	encoders []encoderEntry
+
+	// 没有命中任何路由的时候执行
+	notFound HandleFunc
+	// 路径存在，但是没有注册当前 HTTP 方法的时候执行
+	methodNotAllowed HandleFunc
+
+	// 保护 server，Start 和 Shutdown 往往在不同的 goroutine 里面调用
+	mutex  sync.Mutex
+	server *http.Server
+	// 启动的时候按照注册顺序执行
+	startHooks []Hook
+	// 关闭的时候按照注册顺序的逆序执行
+	shutdownHooks []Hook
+
+	// 请求路径以 / 结尾的时候，重定向到不带 / 的路径
+	redirectTrailingSlash bool
+	// 请求路径里面有 // 或者 . 和 .. 的时候，重定向到清理之后的路径
+	redirectCleanPath bool
+
+	// 按照域名注册的路由树，精确的域名直接查 map，其它的按照优先级排好序
+	hosts        map[string]*hostRouter
+	hostPatterns []*hostRouter
+
+	// 组装好了全局 middleware 的入口
+	handler HandleFunc
+	// 复用 Context
+	pool sync.Pool
 }
 
 func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 	s := &HTTPServer{
-		router: newRouter(),
+		router:           newRouter(),
+		notFound:         defaultNotFound,
+		methodNotAllowed: defaultMethodNotAllowed,
+		encoders:         append([]encoderEntry{}, defaultEncoders...),
 	}
 
 	// 不是核心逻辑，无需在 server interface 中实现，放在 struct 就可以
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.pool.New = func() any {
+		return &Context{}
+	}
+	s.buildHandler()
 
 	return s
 }
@@ -64,13 +117,79 @@ func ServerWithTemplateEngine(tplEngine TemplateEngine) HTTPServerOption {
 	}
 }
 
+// ServerWithNotFoundHandler 自定义 404 的处理逻辑
+// 它和普通的路由一样，会经过全局的 middleware
+func ServerWithNotFoundHandler(handler HandleFunc) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.notFound = handler
+	}
+}
+
+// ServerWithMethodNotAllowedHandler 自定义 405 的处理逻辑
+// 在执行之前，响应头里面已经设置好了 Allow
+func ServerWithMethodNotAllowedHandler(handler HandleFunc) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.methodNotAllowed = handler
+	}
+}
+
+// ServerWithRedirectTrailingSlash 请求 /a/ 的时候，如果 /a 有注册路由，那么重定向到 /a
+// GET 和 HEAD 请求使用 301，其它请求使用 308 以保留请求方法和请求体
+// 默认情况下 /a/ 会直接命中 /a
+func ServerWithRedirectTrailingSlash() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectTrailingSlash = true
+	}
+}
+
+// ServerWithRedirectCleanPath 请求路径里面有 //、. 或者 .. 的时候，
+// 如果清理之后的路径有注册路由，那么重定向过去，例如 /a//b/../c 重定向到 /a/c
+// 重定向的状态码和 ServerWithRedirectTrailingSlash 一样
+func ServerWithRedirectCleanPath() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectCleanPath = true
+	}
+}
+
+// ServerWithCaseInsensitive 静态路由匹配的时候忽略大小写，例如 /User/Home 可以命中 /user/home
+// 路径参数的值保持原样
+func ServerWithCaseInsensitive() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.caseInsensitive = true
+	}
+}
+
+func defaultNotFound(ctx *Context) {
+	ctx.RespStatusCode = http.StatusNotFound
+	ctx.RespData = []byte("Not Found")
+}
+
+func defaultMethodNotAllowed(ctx *Context) {
+	ctx.RespStatusCode = http.StatusMethodNotAllowed
+	ctx.RespData = []byte("Method Not Allowed")
+}
+
 // Use 可以通过调用方法注册 Middleware 也可以改成 Opts 函数选项模式
+// 需要在启动之前调用
 func (s *HTTPServer) Use(mdls ...Middleware) {
 	if s.mdls == nil {
 		s.mdls = mdls
-		return
+	} else {
+		s.mdls = append(s.mdls, mdls...)
 	}
-	s.mdls = append(s.mdls, mdls...)
+	s.buildHandler()
+}
+
+// OnStart 注册启动回调，在开始监听之后，处理请求之前按照注册顺序执行
+// 任何一个回调返回 error，都会终止启动
+func (s *HTTPServer) OnStart(hooks ...Hook) {
+	s.startHooks = append(s.startHooks, hooks...)
+}
+
+// OnShutdown 注册关闭回调，在 Shutdown 等待请求处理完毕之后，按照注册顺序的逆序执行
+// 也就是先注册的资源后释放
+func (s *HTTPServer) OnShutdown(hooks ...Hook) {
+	s.shutdownHooks = append(s.shutdownHooks, hooks...)
 }
 
 //// UseV1 会执行路由匹配，只有匹配上了的 mdls 才会生效
@@ -81,22 +200,34 @@ func (s *HTTPServer) Use(mdls ...Middleware) {
 
 // ServeHTTP is the entry point for a request handler.
 // ServeHTTP 处理请求的入口
+// Context 是从池子里面拿出来的，请求处理完毕之后会被回收，所以不要在 handler 返回之后继续持有 Context
 func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 
 	// 你的框架代码就在这里
 	// 将 http.Request 和 http.ResponseWriter 封装到 Context 里面
-	ctx := &Context{
-		Req:  request,
-		Resp: writer,
-		// 将 template engine 实例到 ctx 中
-		tplEngine: s.tplEngine,
-	}
+	ctx := s.pool.Get().(*Context)
+	ctx.Req = request
+	ctx.Resp = writer
+	// 将 template engine 实例到 ctx 中
+	ctx.tplEngine = s.tplEngine
+	ctx.validator = s.validator
+	ctx.errHandler = s.errHandler
+	ctx.encoders = s.encoders
+
+	s.handler(ctx)
+
+	ctx.reset()
+	s.pool.Put(ctx)
+}
 
+// buildHandler 将全局的 middleware 和 serve 组装在一起
+// 只在创建 server 和调用 Use 的时候组装，而不是每个请求都组装一遍
+func (s *HTTPServer) buildHandler() {
 	// Middleware 和 serve 一起的时候， HTTPServer 执行路由匹配，应该是最后一个，最后一个执行用户的逻辑
 	root := s.serve
 	// 将中间件的逻辑，从后往前 将 root 放在最后一个，注册进去
 	for i := len(s.mdls) - 1; i >= 0; i-- {
-		root = s.mdls[i](root)
+		root = s.mdls[i](abortable(root))
 	}
 
 	// 这里执行的时候，就是从前往后了
@@ -111,42 +242,178 @@ func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 			s.flashResp(ctx)
 		}
 	}
-	root = m(root)
-	root(ctx)
+	s.handler = m(root)
 }
 
 // serve is the core func to find the route and execute the business logic.
 func (s *HTTPServer) serve(ctx *Context) {
+	if len(s.hosts) > 0 || len(s.hostPatterns) > 0 {
+		if h, ok := s.matchHost(ctx.Req.Host, &ctx.mi); ok {
+			if len(ctx.mi.hostParams) > 0 {
+				// 域名的 middleware 也可以拿到域名里面的参数
+				ctx.PathParams = ctx.mi.hostParams
+			}
+			h.handler(ctx)
+			return
+		}
+	}
+	s.serveRouter(ctx, &s.router)
+}
+
+// serveRouter 在 r 里面查找路由，并且执行命中的业务逻辑
+func (s *HTTPServer) serveRouter(ctx *Context, r *router) {
 	// 接下来就是查找路由，并且执行命中的业务逻辑
-	mi, ok := s.findRoute(ctx.Req.Method, ctx.Req.URL.Path)
+	method, path := ctx.Req.Method, ctx.Req.URL.Path
+	if s.redirectTrailingSlash || s.redirectCleanPath {
+		if canonical := s.canonicalPath(path); canonical != path && len(allowedMethods(r, canonical)) > 0 {
+			s.redirect(ctx, canonical)
+			return
+		}
+	}
+	mi := &ctx.mi
+	ok := r.match(method, path, mi)
+	if (!ok || mi.n.handler == nil) && method == http.MethodHead {
+		// 没有注册 HEAD 的时候，交给 GET 处理，响应体在回写的时候会被丢弃
+		mi.resetRoute()
+		ok = r.match(http.MethodGet, path, mi)
+	}
 	if !ok || mi.n.handler == nil {
-		ctx.Resp.WriteHeader(404)
-		_, _ = ctx.Resp.Write([]byte("Not Found"))
+		allowed := allowedMethods(r, path)
+		if len(allowed) == 0 {
+			s.notFound(ctx)
+			return
+		}
+		ctx.Resp.Header().Set("Allow", strings.Join(allowed, ", "))
+		if method == http.MethodOptions {
+			// 没有注册 OPTIONS 的时候，自动响应
+			ctx.RespStatusCode = http.StatusNoContent
+			return
+		}
+		s.methodNotAllowed(ctx)
 		return
 	}
-	ctx.PathParams = mi.pathParams
+	mi.mergeHostParams()
+	if len(mi.pathParams) > 0 {
+		ctx.PathParams = mi.pathParams
+	}
+	if len(mi.typedParams) > 0 {
+		ctx.typedParams = mi.typedParams
+	}
 	ctx.MatchedRoute = mi.n.route
 
-	// 这里需要处理路径中的 middlewares
-	root := mi.n.handler
-	for i := len(mi.mdls) - 1; i >= 0; i-- {
-		root = mi.mdls[i](root)
-	}
+	// 路径中的 middlewares 在注册路由的时候已经组装好了
 	// 最终执行 用户逻辑
-	root(ctx)
+	mi.n.chain(ctx)
+}
+
+// canonicalPath 按照配置清理路径
+func (s *HTTPServer) canonicalPath(path string) string {
+	if s.redirectCleanPath && needClean(path) {
+		cleaned := pathpkg.Clean(path)
+		// path.Clean 会去掉结尾的 /，这个交给 redirectTrailingSlash 处理
+		if strings.HasSuffix(path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		path = cleaned
+	}
+	if s.redirectTrailingSlash && len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+	if strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		// //evil.com 会被浏览器当成另外一个域名，不能作为重定向的目标
+		// 浏览器会把 \ 当成 /，所以 /\evil.com 也一样
+		path = "/" + strings.TrimLeft(path, "/\\")
+	}
+	return path
+}
+
+// needClean 大多数请求的路径都是干净的，避免每次都调用 path.Clean
+func needClean(path string) bool {
+	if path == "" || path[0] != '/' {
+		return true
+	}
+	return strings.Contains(path, "//") ||
+		strings.Contains(path, "/./") || strings.Contains(path, "/../") ||
+		strings.HasSuffix(path, "/.") || strings.HasSuffix(path, "/..")
+}
+
+// redirect 重定向到规范的路径，保留查询参数
+// path 是解码之后的路径，需要重新转义，否则 %3F 解码出来的 ? 之类的字符会改变 URL 的含义
+func (s *HTTPServer) redirect(ctx *Context, path string) {
+	code := http.StatusPermanentRedirect
+	if ctx.Req.Method == http.MethodGet || ctx.Req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	path = (&url.URL{Path: path}).EscapedPath()
+	if ctx.Req.URL.RawQuery != "" {
+		path += "?" + ctx.Req.URL.RawQuery
+	}
+	_ = ctx.Redirect(code, path)
+}
+
+// allowedMethods 找出 path 在 r 的哪些 HTTP 方法下有注册路由
+// GET 隐含了 HEAD，而 OPTIONS 总是可以自动响应的
+func allowedMethods(r *router, path string) []string {
+	res := make([]string, 0, len(r.trees)+2)
+	for method := range r.trees {
+		mi, ok := r.findRoute(method, path)
+		if ok && mi.n.handler != nil {
+			res = append(res, method)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	var hasGet, hasHead, hasOptions bool
+	for _, method := range res {
+		switch method {
+		case http.MethodGet:
+			hasGet = true
+		case http.MethodHead:
+			hasHead = true
+		case http.MethodOptions:
+			hasOptions = true
+		}
+	}
+	if hasGet && !hasHead {
+		res = append(res, http.MethodHead)
+	}
+	if !hasOptions {
+		res = append(res, http.MethodOptions)
+	}
+	sort.Strings(res)
+	return res
 }
 
 func (s *HTTPServer) flashResp(ctx *Context) {
-	if ctx.RespStatusCode > 0 {
-		ctx.Resp.WriteHeader(ctx.RespStatusCode)
+	if err := ctx.writeResp(); err != nil {
+		// 大多数时候是客户端已经断开了连接，不应该影响其它请求
+		log.Printf("kyuu: 回写响应失败 %s %s %v", ctx.Req.Method, ctx.Req.URL.Path, err)
 	}
-	_, err := ctx.Resp.Write(ctx.RespData)
-	if err != nil {
-		log.Fatalln("回写响应失败", err)
+}
+
+// writeResp 将缓存的 RespStatusCode 和 RespData 写入 Resp
+func (c *Context) writeResp() error {
+	if c.streaming || c.hijacked || c.fileServed {
+		// 流式响应和 RespFile 已经直接写入 Resp 了，被接管的连接则不能再写入
+		return nil
+	}
+	if c.RespStatusCode > 0 {
+		c.Resp.WriteHeader(c.RespStatusCode)
 	}
+	if c.Req.Method == http.MethodHead || len(c.RespData) == 0 {
+		// HEAD 请求不需要响应体，204 之类的响应也不允许写入响应体
+		return nil
+	}
+	_, err := c.Resp.Write(c.RespData)
+	return err
 }
 
 // Start starts the HTTP server.
+// 调用 Shutdown 之后，Start 会返回 nil
 func (s *HTTPServer) Start(addr string) error {
 	// 也可以自己创建 Server
 	// http.Server{}
@@ -171,12 +438,74 @@ func (s *HTTPServer) Start(addr string) error {
 	if err != nil {
 		return err
 	}
+	return s.start(l)
+}
+
+func (s *HTTPServer) start(l net.Listener) error {
+	s.mutex.Lock()
+	if s.server != nil {
+		s.mutex.Unlock()
+		_ = l.Close()
+		return errors.New("kyuu: 服务器已经启动")
+	}
+	// 就是因为这里需要 http.Handler 才能启动，所以才需要继承 http.Handler 接口
+	srv := &http.Server{Handler: s}
+	s.server = srv
+	s.mutex.Unlock()
+
 	// 在这里，可以让用户注册所谓的 after start 回调 Hook
 	// 比如说往你的 admin 注册一下自己这个实例
 	// 在这里执行一些你业务所需的前置条件
+	for _, hook := range s.startHooks {
+		if err := hook(context.Background()); err != nil {
+			_ = l.Close()
+			return err
+		}
+	}
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown 优雅退出
+// 1. 不再接收新的连接
+// 2. 等待已有的请求处理完毕
+// 3. 逆序执行 OnShutdown 注册的回调
+// 整个过程受到 ctx 的超时控制。即便已经超时，依旧会触发剩余的回调释放资源，只是不再等待它们结束
+// 返回的是遇到的第一个 error
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	srv := s.server
+	s.mutex.Unlock()
+
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
 
-	// 就是因为这里需要 addr 和 http.Handler 才能启动，所以才需要继承 http.Handler 接口
-	return http.Serve(l, s)
+	for i := len(s.shutdownHooks) - 1; i >= 0; i-- {
+		if er := runHook(ctx, s.shutdownHooks[i]); er != nil && err == nil {
+			err = er
+		}
+	}
+	return err
+}
+
+// runHook 执行回调，回调超过 ctx 的期限就不再等待
+func runHook(ctx context.Context, hook Hook) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 //// Start1 这样也可以
@@ -184,6 +513,19 @@ func (s *HTTPServer) Start(addr string) error {
 //	return http.ListenAndServe(addr, s)
 //}
 
+// NamedRoute 注册一个命名路由，之后可以通过 URLFor 反向生成 URL
+func (s *HTTPServer) NamedRoute(name string, method string, path string, handleFunc HandleFunc, ms ...Middleware) {
+	s.addNamedRoute(name, method, path, handleFunc, ms...)
+}
+
+// URLFor 根据路由名字反向生成 URL，例如注册了 user => /user/:id(^[0-9]+$)
+// 那么 URLFor("user", map[string]string{"id": "123"}, url.Values{"tab": {"home"}})
+// 得到的是 /user/123?tab=home
+// 缺少路径参数，或者路径参数不匹配正则表达式的时候返回 error
+func (s *HTTPServer) URLFor(name string, params map[string]string, query url.Values) (string, error) {
+	return s.urlFor(name, params, query)
+}
+
 func (s *HTTPServer) Get(path string, handleFunc HandleFunc) {
 	s.addRoute(http.MethodGet, path, handleFunc)
 }
@@ -207,3 +549,7 @@ func (s *HTTPServer) Patch(path string, handleFunc HandleFunc) {
 func (s *HTTPServer) Options(path string, handleFunc HandleFunc) {
 	s.addRoute(http.MethodOptions, path, handleFunc)
 }
+
+func (s *HTTPServer) Head(path string, handleFunc HandleFunc) {
+	s.addRoute(http.MethodHead, path, handleFunc)
+}
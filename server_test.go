@@ -1 +1,505 @@
 package kyuu
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	s := NewHTTPServer()
+
+	var events []string
+	s.OnStart(func(ctx context.Context) error {
+		events = append(events, "start")
+		return nil
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "close db")
+		return nil
+	}, func(ctx context.Context) error {
+		events = append(events, "close session store")
+		return nil
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.Get("/slow", func(ctx *Context) {
+		close(started)
+		<-release
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte("done")
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.start(l)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	respCh := make(chan result, 1)
+	go func() {
+		resp, er := http.Get("http://" + l.Addr().String() + "/slow")
+		if er != nil {
+			respCh <- result{err: er}
+			return
+		}
+		defer resp.Body.Close()
+		data, er := io.ReadAll(resp.Body)
+		respCh <- result{body: string(data), err: er}
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		shutdownErr <- s.Shutdown(ctx)
+	}()
+
+	// Shutdown 需要等待正在处理的请求
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown 没有等待请求处理完毕")
+	case <-time.After(time.Millisecond * 100):
+	}
+	close(release)
+
+	res := <-respCh
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-shutdownErr)
+	assert.NoError(t, <-serveErr)
+	assert.Equal(t, []string{"start", "close session store", "close db"}, events)
+}
+
+func TestHTTPServer_ShutdownHookTimeout(t *testing.T) {
+	s := NewHTTPServer()
+	hookErr := errors.New("hook error")
+	closed := make(chan struct{})
+	s.OnShutdown(func(ctx context.Context) error {
+		close(closed)
+		return nil
+	}, func(ctx context.Context) error {
+		return hookErr
+	}, func(ctx context.Context) error {
+		<-time.After(time.Second)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// 超时之后，后续的回调还是会被触发，只是不再等待它们结束
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("超时之后没有触发剩余的回调")
+	}
+}
+
+func TestHTTPServer_StartHookError(t *testing.T) {
+	s := NewHTTPServer()
+	hookErr := errors.New("hook error")
+	s.OnStart(func(ctx context.Context) error {
+		return hookErr
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Equal(t, hookErr, s.start(l))
+}
+
+func TestHTTPServer_NotFoundAndMethodNotAllowed(t *testing.T) {
+	handler := func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(ctx.Req.Method)
+	}
+	var mdlCalled int
+	newServer := func(opts ...HTTPServerOption) *HTTPServer {
+		s := NewHTTPServer(opts...)
+		s.Use(func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				mdlCalled++
+				next(ctx)
+			}
+		})
+		s.Get("/user", handler)
+		s.Post("/user", handler)
+		s.Delete("/user/:id", handler)
+		s.Options("/order", handler)
+		s.Put("/order", handler)
+		return s
+	}
+
+	testCases := []struct {
+		name      string
+		server    *HTTPServer
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{
+			name:     "not found",
+			server:   newServer(),
+			method:   http.MethodGet,
+			path:     "/abc",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name: "custom not found",
+			server: newServer(ServerWithNotFoundHandler(func(ctx *Context) {
+				ctx.RespStatusCode = http.StatusNotFound
+				ctx.RespData = []byte("custom " + ctx.Req.URL.Path)
+			})),
+			method:   http.MethodGet,
+			path:     "/abc",
+			wantCode: http.StatusNotFound,
+			wantBody: "custom /abc",
+		},
+		{
+			name:      "method not allowed",
+			server:    newServer(),
+			method:    http.MethodPut,
+			path:      "/user",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "Method Not Allowed",
+			wantAllow: "GET, HEAD, OPTIONS, POST",
+		},
+		{
+			name:      "method not allowed with param",
+			server:    newServer(),
+			method:    http.MethodGet,
+			path:      "/user/123",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "Method Not Allowed",
+			wantAllow: "DELETE, OPTIONS",
+		},
+		{
+			name: "custom method not allowed",
+			server: newServer(ServerWithMethodNotAllowedHandler(func(ctx *Context) {
+				ctx.RespStatusCode = http.StatusMethodNotAllowed
+				ctx.RespData = []byte("custom " + ctx.Resp.Header().Get("Allow"))
+			})),
+			method:    http.MethodPatch,
+			path:      "/order",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "custom OPTIONS, PUT",
+			wantAllow: "OPTIONS, PUT",
+		},
+		{
+			name:     "auto head",
+			server:   newServer(),
+			method:   http.MethodHead,
+			path:     "/user",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "auto options",
+			server:    newServer(),
+			method:    http.MethodOptions,
+			path:      "/user",
+			wantCode:  http.StatusNoContent,
+			wantAllow: "GET, HEAD, OPTIONS, POST",
+		},
+		{
+			name:     "registered options",
+			server:   newServer(),
+			method:   http.MethodOptions,
+			path:     "/order",
+			wantCode: http.StatusOK,
+			wantBody: http.MethodOptions,
+		},
+		{
+			name:     "options not found",
+			server:   newServer(),
+			method:   http.MethodOptions,
+			path:     "/abc",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mdlCalled = 0
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			recorder := httptest.NewRecorder()
+			tc.server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantAllow, recorder.Header().Get("Allow"))
+			// 不管有没有命中路由，都会经过全局的 middleware
+			assert.Equal(t, 1, mdlCalled)
+		})
+	}
+}
+
+func TestHTTPServer_ContextReuse(t *testing.T) {
+	s := NewHTTPServer()
+	s.Get("/user/:id", func(ctx *Context) {
+		assert.Nil(t, ctx.UserValues)
+		assert.Nil(t, ctx.RespData)
+		ctx.UserValues = map[string]any{"id": ctx.PathParams["id"]}
+		ctx.RespData = []byte(ctx.PathParams["id"])
+	})
+	s.Get("/static", func(ctx *Context) {
+		// 上一个请求的路径参数不能泄漏到这里
+		assert.Nil(t, ctx.PathParams)
+		assert.Nil(t, ctx.UserValues)
+		ctx.RespData = []byte("static")
+	})
+	for _, tc := range []struct {
+		path     string
+		wantBody string
+	}{
+		{path: "/user/1", wantBody: "1"},
+		{path: "/static", wantBody: "static"},
+		{path: "/user/2", wantBody: "2"},
+		{path: "/static", wantBody: "static"},
+	} {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		assert.Equal(t, tc.wantBody, recorder.Body.String())
+	}
+}
+
+// nopResponseWriter 避免 httptest.ResponseRecorder 本身的内存分配影响测试结果
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (w *nopResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *nopResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *nopResponseWriter) WriteHeader(statusCode int) {}
+
+func BenchmarkHTTPServer_ServeHTTP(b *testing.B) {
+	s := NewHTTPServer()
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	})
+	handler := func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusOK
+	}
+	s.Get("/user/home", handler)
+	s.Get("/user/:id", handler)
+	s.Get("/order/:id(^[0-9]+$)", handler)
+	s.Get("/static/*", handler)
+	s.Get("/item/:id<int>", handler)
+	s.Host(":tenant.example.com").Get("/user/:id", handler)
+
+	testCases := []struct {
+		name string
+		path string
+	}{
+		{name: "static", path: "/user/home"},
+		{name: "param", path: "/user/123"},
+		{name: "regex", path: "/order/123"},
+		{name: "wildcard", path: "/static/js/app.js"},
+		{name: "typed", path: "/item/123"},
+		{name: "host", path: "http://acme.example.com/user/123"},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			writer := &nopResponseWriter{header: http.Header{}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.ServeHTTP(writer, req)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_RedirectAndCaseInsensitive(t *testing.T) {
+	handler := func(ctx *Context) {
+		ctx.RespString(http.StatusOK, ctx.MatchedRoute+" "+ctx.PathParams["id"])
+	}
+	register := func(s *HTTPServer) {
+		s.Get("/user/home", handler)
+		s.Get("/user/:id", handler)
+		s.Post("/order", handler)
+		s.Get("/", handler)
+	}
+
+	testCases := []struct {
+		name         string
+		opts         []HTTPServerOption
+		method       string
+		path         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:     "default trailing slash",
+			method:   http.MethodGet,
+			path:     "/user/home/",
+			wantCode: http.StatusOK,
+			wantBody: "/user/home ",
+		},
+		{
+			name:         "trailing slash",
+			opts:         []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:       http.MethodGet,
+			path:         "/user/home/?a=b",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home?a=b",
+		},
+		{
+			// 解码之后的 ? 要重新转义，否则会变成查询参数
+			name:         "trailing slash escaped",
+			opts:         []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:       http.MethodGet,
+			path:         "/user/a%3Fb/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/a%3Fb",
+		},
+		{
+			name:         "trailing slash post",
+			opts:         []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:       http.MethodPost,
+			path:         "/order/",
+			wantCode:     http.StatusPermanentRedirect,
+			wantLocation: "/order",
+		},
+		{
+			name:     "trailing slash not found",
+			opts:     []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:   http.MethodGet,
+			path:     "/product/",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:         "clean path",
+			opts:         []HTTPServerOption{ServerWithRedirectCleanPath()},
+			method:       http.MethodGet,
+			path:         "/user//./static/../123",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/123",
+		},
+		{
+			// 没有开启 trailing slash 的时候，保留结尾的 /
+			name:         "clean path keeps trailing slash",
+			opts:         []HTTPServerOption{ServerWithRedirectCleanPath()},
+			method:       http.MethodGet,
+			path:         "//user/home/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home/",
+		},
+		{
+			name:         "clean path and trailing slash",
+			opts:         []HTTPServerOption{ServerWithRedirectCleanPath(), ServerWithRedirectTrailingSlash()},
+			method:       http.MethodGet,
+			path:         "//user/home/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home",
+		},
+		{
+			name:     "clean path not needed",
+			opts:     []HTTPServerOption{ServerWithRedirectCleanPath(), ServerWithRedirectTrailingSlash()},
+			method:   http.MethodGet,
+			path:     "/user/123",
+			wantCode: http.StatusOK,
+			wantBody: "/user/:id 123",
+		},
+		{
+			name:     "case sensitive",
+			method:   http.MethodGet,
+			path:     "/User/Home",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "case insensitive",
+			opts:     []HTTPServerOption{ServerWithCaseInsensitive()},
+			method:   http.MethodGet,
+			path:     "/User/Home",
+			wantCode: http.StatusOK,
+			wantBody: "/user/home ",
+		},
+		{
+			name:     "case insensitive param",
+			opts:     []HTTPServerOption{ServerWithCaseInsensitive()},
+			method:   http.MethodGet,
+			path:     "/USER/Tom",
+			wantCode: http.StatusOK,
+			wantBody: "/user/:id Tom",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			register(s)
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPServer_RedirectLeadingSlash(t *testing.T) {
+	s := NewHTTPServer(ServerWithRedirectTrailingSlash())
+	s.Get("/:slug", func(ctx *Context) {
+		ctx.RespString(http.StatusOK, ctx.PathParams["slug"])
+	})
+	// 浏览器会把 //evil.com 和 /\evil.com 都当成另外一个域名
+	testCases := []struct {
+		name         string
+		path         string
+		wantLocation string
+	}{
+		{
+			name:         "double slash",
+			path:         "//evil.com/",
+			wantLocation: "/evil.com",
+		},
+		{
+			name:         "backslash",
+			path:         "/%5Cevil.com/",
+			wantLocation: "/evil.com",
+		},
+		{
+			name:         "escaped backslash",
+			path:         "/%5C%5Cevil.com/",
+			wantLocation: "/evil.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+tc.path, nil)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package kyuu
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamWriter 流式响应
+// 写入的数据会绕开 RespData 直接发送给客户端，所以中间件没有办法再修改响应体。
+// 但是 RespStatusCode 依旧会被设置，accesslog、prometheus 之类的中间件可以正常工作
+type StreamWriter struct {
+	ctx *Context
+}
+
+// Stream 开启流式响应，立刻把响应码和响应头发送出去
+// 在这之前设置好响应头，在这之后对响应头的修改都不会生效
+// 如果 Resp 不支持 http.Flusher，那么返回 error
+func (c *Context) Stream(code int) (*StreamWriter, error) {
+	if c.streaming {
+		return nil, errors.New("kyuu: 已经开启了流式响应")
+	}
+	flusher, ok := c.Resp.(http.Flusher)
+	if !ok {
+		return nil, errors.New("kyuu: ResponseWriter 不支持 Flush，无法开启流式响应")
+	}
+	c.streaming = true
+	c.RespStatusCode = code
+	c.Resp.WriteHeader(code)
+	flusher.Flush()
+	return &StreamWriter{ctx: c}, nil
+}
+
+// IsStreaming 是否开启了流式响应
+func (c *Context) IsStreaming() bool {
+	return c.streaming
+}
+
+// Write 写入数据，但是不会立刻发送，需要调用 Flush
+// 客户端断开连接之后返回 error
+func (w *StreamWriter) Write(data []byte) (int, error) {
+	if err := w.ctx.Req.Context().Err(); err != nil {
+		return 0, err
+	}
+	return w.ctx.Resp.Write(data)
+}
+
+// Flush 将已经写入的数据发送给客户端
+func (w *StreamWriter) Flush() error {
+	if err := w.ctx.Req.Context().Err(); err != nil {
+		return err
+	}
+	// 中间件有可能替换掉 Resp，所以每次都要重新判断
+	flusher, ok := w.ctx.Resp.(http.Flusher)
+	if !ok {
+		return errors.New("kyuu: ResponseWriter 不支持 Flush")
+	}
+	flusher.Flush()
+	return nil
+}
+
+// Done 客户端断开连接，或者请求被取消的时候关闭
+func (w *StreamWriter) Done() <-chan struct{} {
+	return w.ctx.Req.Context().Done()
+}
+
+// SSEEvent 一个 Server-Sent Events 事件
+type SSEEvent struct {
+	// ID 事件 ID，客户端重连的时候会通过 Last-Event-ID 带回来
+	ID string
+	// Event 事件名字，为空的时候客户端当作 message 处理
+	Event string
+	// Data 事件数据，多行数据会被拆分成多个 data 字段
+	Data string
+	// Retry 建议客户端的重连间隔，为 0 的时候不发送
+	Retry time.Duration
+}
+
+// SSEWriter Server-Sent Events 响应
+type SSEWriter struct {
+	w *StreamWriter
+}
+
+// SSE 开启 Server-Sent Events 响应
+func (c *Context) SSE() (*SSEWriter, error) {
+	header := c.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 告诉 nginx 之类的代理不要缓存响应
+	header.Set("X-Accel-Buffering", "no")
+	w, err := c.Stream(http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &SSEWriter{w: w}, nil
+}
+
+// Send 发送一个事件，并且立刻 Flush
+func (s *SSEWriter) Send(evt SSEEvent) error {
+	var sb strings.Builder
+	if evt.ID != "" {
+		sb.WriteString("id: ")
+		sb.WriteString(sseSanitize(evt.ID))
+		sb.WriteByte('\n')
+	}
+	if evt.Event != "" {
+		sb.WriteString("event: ")
+		sb.WriteString(sseSanitize(evt.Event))
+		sb.WriteByte('\n')
+	}
+	if evt.Retry > 0 {
+		sb.WriteString("retry: ")
+		sb.WriteString(strconv.FormatInt(evt.Retry.Milliseconds(), 10))
+		sb.WriteByte('\n')
+	}
+	data := strings.ReplaceAll(evt.Data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	return s.write(sb.String())
+}
+
+// Comment 发送注释，客户端会忽略它，一般用来做心跳，防止连接被代理断开
+func (s *SSEWriter) Comment(text string) error {
+	return s.write(": " + sseSanitize(text) + "\n\n")
+}
+
+// Done 客户端断开连接的时候关闭
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.w.Done()
+}
+
+func (s *SSEWriter) write(msg string) error {
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// sseSanitize id、event 之类的字段不允许换行
+func sseSanitize(val string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(val)
+}
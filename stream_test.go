@@ -0,0 +1,108 @@
+package kyuu
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContext_SSE(t *testing.T) {
+	s := NewHTTPServer()
+	var statusInMdl int
+	s.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			statusInMdl = ctx.RespStatusCode
+		}
+	})
+	s.Get("/events", func(ctx *Context) {
+		sse, err := ctx.SSE()
+		require.NoError(t, err)
+		require.NoError(t, sse.Send(SSEEvent{ID: "1", Event: "greeting", Data: "hello\nworld", Retry: time.Second}))
+		require.NoError(t, sse.Comment("ping"))
+		require.NoError(t, sse.Send(SSEEvent{Data: "bye"}))
+		// 流式响应之后 RespData 不再生效
+		ctx.RespData = []byte("ignored")
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+	assert.Equal(t, "id: 1\nevent: greeting\nretry: 1000\ndata: hello\ndata: world\n\n"+
+		": ping\n\n"+
+		"data: bye\n\n", recorder.Body.String())
+	assert.Equal(t, http.StatusOK, statusInMdl)
+}
+
+func TestContext_Stream(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ctx      func() context.Context
+		resp     http.ResponseWriter
+		wantErr  string
+		wantBody string
+	}{
+		{
+			name:     "stream",
+			ctx:      context.Background,
+			resp:     httptest.NewRecorder(),
+			wantBody: "chunk1chunk2",
+		},
+		{
+			name: "client gone",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			resp:    httptest.NewRecorder(),
+			wantErr: "context canceled",
+		},
+		{
+			name:    "not flusher",
+			ctx:     context.Background,
+			resp:    struct{ http.ResponseWriter }{httptest.NewRecorder()},
+			wantErr: "kyuu: ResponseWriter 不支持 Flush，无法开启流式响应",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tc.ctx())
+			ctx := &Context{Req: req, Resp: tc.resp}
+			err := func() error {
+				w, err := ctx.Stream(http.StatusAccepted)
+				if err != nil {
+					return err
+				}
+				for _, chunk := range []string{"chunk1", "chunk2"} {
+					if _, err = w.Write([]byte(chunk)); err != nil {
+						return err
+					}
+					if err = w.Flush(); err != nil {
+						return err
+					}
+				}
+				return nil
+			}()
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, ctx.IsStreaming())
+			assert.Equal(t, http.StatusAccepted, ctx.RespStatusCode)
+			assert.Equal(t, tc.wantBody, tc.resp.(*httptest.ResponseRecorder).Body.String())
+
+			_, err = ctx.Stream(http.StatusOK)
+			assert.EqualError(t, err, "kyuu: 已经开启了流式响应")
+		})
+	}
+}
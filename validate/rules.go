@@ -0,0 +1,279 @@
+package validate
+
+import (
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var builtinRules = map[string]Rule{
+	"required": required,
+	"min":      compareParam(func(c int) bool { return c >= 0 }),
+	"max":      compareParam(func(c int) bool { return c <= 0 }),
+	"len":      compareParam(func(c int) bool { return c == 0 }),
+	"eq":       equalParam(true),
+	"ne":       equalParam(false),
+	"gt":       compareParam(func(c int) bool { return c > 0 }),
+	"gte":      compareParam(func(c int) bool { return c >= 0 }),
+	"lt":       compareParam(func(c int) bool { return c < 0 }),
+	"lte":      compareParam(func(c int) bool { return c <= 0 }),
+	"oneof":    oneOf,
+	"email":    stringRule(isEmail),
+	"url":      stringRule(isURL),
+	"uuid":     stringRule(uuidRegexp.MatchString),
+	"alpha":    stringRule(allRunes(unicode.IsLetter)),
+	"alphanum": stringRule(allRunes(func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })),
+	"numeric":  stringRule(numericRegexp.MatchString),
+	"eqfield":  compareField(func(c int) bool { return c == 0 }),
+	"nefield":  compareField(func(c int) bool { return c != 0 }),
+	"gtfield":  compareField(func(c int) bool { return c > 0 }),
+	"gtefield": compareField(func(c int) bool { return c >= 0 }),
+	"ltfield":  compareField(func(c int) bool { return c < 0 }),
+	"ltefield": compareField(func(c int) bool { return c <= 0 }),
+}
+
+var (
+	uuidRegexp    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericRegexp = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+)
+
+// required 零值认为是空，指针、切片、map 为 nil 或者长度为 0 也认为是空
+func required(f Field) bool {
+	v := f.Value
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil()
+	}
+	return !v.IsZero()
+}
+
+// compareParam 将字段和参数比较
+// 数字比较的是值，字符串比较的是字符数（eq 和 ne 除外），切片、map 和数组比较的是长度，time.Duration 的参数可以写成 1s 这种形式
+func compareParam(ok func(c int) bool) Rule {
+	return func(f Field) bool {
+		v := indirect(f.Value)
+		if !v.IsValid() {
+			return true
+		}
+		c, valid := compareWithParam(v, f.Param)
+		return valid && ok(c)
+	}
+}
+
+// equalParam 字符串比较的是内容，其它类型和 compareParam 一样
+func equalParam(want bool) Rule {
+	cmp := compareParam(func(c int) bool { return (c == 0) == want })
+	return func(f Field) bool {
+		v := indirect(f.Value)
+		if v.IsValid() && v.Kind() == reflect.String {
+			return (v.String() == f.Param) == want
+		}
+		return cmp(f)
+	}
+}
+
+func compareWithParam(v reflect.Value, param string) (int, bool) {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		if d, err := time.ParseDuration(param); err == nil {
+			return compareInt(v.Int(), int64(d)), true
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		p, err := strconv.Atoi(param)
+		if err != nil {
+			return 0, false
+		}
+		return compareInt(int64(utf8.RuneCountInString(v.String())), int64(p)), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		p, err := strconv.Atoi(param)
+		if err != nil {
+			return 0, false
+		}
+		return compareInt(int64(v.Len()), int64(p)), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareInt(v.Int(), p), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case v.Uint() < p:
+			return -1, true
+		case v.Uint() > p:
+			return 1, true
+		}
+		return 0, true
+	case reflect.Float32, reflect.Float64:
+		p, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloat(v.Float(), p), true
+	}
+	return 0, false
+}
+
+// compareField 跨字段比较，参数是同一个结构体里面另一个字段的 Go 名字
+func compareField(ok func(c int) bool) Rule {
+	return func(f Field) bool {
+		if !f.Parent.IsValid() {
+			return false
+		}
+		other := f.Parent.FieldByName(f.Param)
+		if !other.IsValid() {
+			return false
+		}
+		c, valid := compareValues(indirect(f.Value), indirect(other))
+		return valid && ok(c)
+	}
+}
+
+func compareValues(x, y reflect.Value) (int, bool) {
+	if !x.IsValid() || !y.IsValid() {
+		// 都是 nil 的时候认为相等
+		return 0, !x.IsValid() && !y.IsValid()
+	}
+	if x.Type() != y.Type() {
+		return 0, false
+	}
+	if x.Type() == timeType {
+		tx, ty := x.Interface().(time.Time), y.Interface().(time.Time)
+		switch {
+		case tx.Before(ty):
+			return -1, true
+		case tx.After(ty):
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x.Kind() {
+	case reflect.String:
+		return strings.Compare(x.String(), y.String()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareInt(x.Int(), y.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch {
+		case x.Uint() < y.Uint():
+			return -1, true
+		case x.Uint() > y.Uint():
+			return 1, true
+		}
+		return 0, true
+	case reflect.Float32, reflect.Float64:
+		return compareFloat(x.Float(), y.Float()), true
+	}
+	if x.Type().Comparable() {
+		// 其它可比较的类型只支持相等和不相等
+		if x.Interface() == y.Interface() {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func compareInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// oneOf 参数用空格分隔，例如 oneof=red green blue
+func oneOf(f Field) bool {
+	v := indirect(f.Value)
+	if !v.IsValid() {
+		return true
+	}
+	var val string
+	switch v.Kind() {
+	case reflect.String:
+		val = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val = strconv.FormatUint(v.Uint(), 10)
+	default:
+		return false
+	}
+	for _, p := range strings.Fields(f.Param) {
+		if p == val {
+			return true
+		}
+	}
+	return false
+}
+
+// stringRule 只能用在字符串上的规则，空字符串交给 required 处理
+func stringRule(ok func(s string) bool) Rule {
+	return func(f Field) bool {
+		v := indirect(f.Value)
+		if !v.IsValid() {
+			return true
+		}
+		if v.Kind() != reflect.String {
+			return false
+		}
+		return v.String() == "" || ok(v.String())
+	}
+}
+
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	// 不允许 "Tom <tom@example.com>" 这种带名字的形式
+	return err == nil && addr.Address == s
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func allRunes(ok func(r rune) bool) func(s string) bool {
+	return func(s string) bool {
+		for _, r := range s {
+			if !ok(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// indirect 解引用指针，nil 指针返回无效的 reflect.Value
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
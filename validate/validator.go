@@ -0,0 +1,313 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 使用的 struct tag
+const tagName = "validate"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Field 校验规则的输入
+type Field struct {
+	// Name 字段名字，优先使用 json 标签里面的名字
+	Name string
+	// Value 字段的值
+	Value reflect.Value
+	// Param 规则的参数，例如 min=1 里面的 1
+	Param string
+	// Parent 字段所在的结构体，跨字段的规则通过它拿到其它字段
+	Parent reflect.Value
+}
+
+// Rule 校验规则，返回 false 代表校验失败
+type Rule func(f Field) bool
+
+// FieldError 一个字段的校验失败信息
+type FieldError struct {
+	// Field 字段的路径，嵌套的结构体用 . 连接，切片元素带上下标，例如 items[0].name
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// Errors 所有校验失败的字段，可以直接作为 400 的 JSON 响应返回
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Message)
+	}
+	return "validate: " + strings.Join(msgs, "; ")
+}
+
+// Validator 根据 validate 标签校验结构体
+//
+//	type SignUpReq struct {
+//		Email           string `json:"email" validate:"required,email"`
+//		Password        string `json:"password" validate:"required,min=8,max=64"`
+//		ConfirmPassword string `json:"confirm_password" validate:"eqfield=Password"`
+//		Role            string `json:"role" validate:"omitempty,oneof=admin member"`
+//	}
+//
+// 规则之间用 , 分隔，规则的参数用 = 连接
+type Validator struct {
+	mutex sync.RWMutex
+	rules map[string]Rule
+	// 解析好的 struct 标签，避免每次都解析
+	structs sync.Map
+}
+
+// New 创建一个 Validator，内置了常用的规则
+func New() *Validator {
+	v := &Validator{rules: make(map[string]Rule, len(builtinRules))}
+	for name, rule := range builtinRules {
+		v.rules[name] = rule
+	}
+	return v
+}
+
+// Default 默认的 Validator，Struct 和 RegisterRule 使用的都是它
+// kyuu.Context 默认不会在绑定数据之后校验，需要通过 kyuu.ServerWithValidator(validate.Default) 开启
+var Default = New()
+
+// RegisterRule 在 Default 上注册自定义规则
+func RegisterRule(name string, rule Rule) {
+	Default.RegisterRule(name, rule)
+}
+
+// Struct 使用 Default 校验结构体
+func Struct(val any) error {
+	return Default.ValidateStruct(val)
+}
+
+// RegisterRule 注册自定义规则，同名规则会被覆盖
+// 跨字段的规则可以通过 Field.Parent 拿到同一个结构体的其它字段
+func (v *Validator) RegisterRule(name string, rule Rule) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.rules[name] = rule
+}
+
+func (v *Validator) rule(name string) (Rule, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	r, ok := v.rules[name]
+	return r, ok
+}
+
+// ValidateStruct 校验结构体，val 可以是结构体或者指向结构体的指针，其它类型直接通过
+// 校验失败的时候返回 Errors
+func (v *Validator) ValidateStruct(val any) error {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs Errors
+	if err := v.validateStruct(rv, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type ruleItem struct {
+	name  string
+	param string
+}
+
+type fieldInfo struct {
+	index     int
+	name      string
+	rules     []ruleItem
+	omitEmpty bool
+	// 组合的结构体
+	embedded bool
+}
+
+// parseStruct 解析结构体上的 validate 标签
+func (v *Validator) parseStruct(typ reflect.Type) ([]fieldInfo, error) {
+	if res, ok := v.structs.Load(typ); ok {
+		return res.([]fieldInfo), nil
+	}
+	res := make([]fieldInfo, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		if !fd.IsExported() && !fd.Anonymous {
+			continue
+		}
+		fi := fieldInfo{
+			index:    i,
+			name:     fieldName(fd),
+			embedded: fd.Anonymous && fd.Type.Kind() == reflect.Struct,
+		}
+		tag := fd.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+		for _, r := range strings.Split(tag, ",") {
+			r = strings.TrimSpace(r)
+			if r == "" {
+				continue
+			}
+			if r == "omitempty" {
+				fi.omitEmpty = true
+				continue
+			}
+			name, param, _ := strings.Cut(r, "=")
+			if _, ok := v.rule(name); !ok {
+				return nil, fmt.Errorf("validate: 未知的规则 %s，字段 %s.%s", name, typ.Name(), fd.Name)
+			}
+			fi.rules = append(fi.rules, ruleItem{name: name, param: param})
+		}
+		res = append(res, fi)
+	}
+	v.structs.Store(typ, res)
+	return res, nil
+}
+
+// fieldName 优先使用 json 标签里面的名字，这样返回给前端的字段名字和请求里面的一致
+func fieldName(fd reflect.StructField) string {
+	if tag := fd.Tag.Get("json"); tag != "" {
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return fd.Name
+}
+
+func (v *Validator) validateStruct(rv reflect.Value, prefix string, errs *Errors) error {
+	fields, err := v.parseStruct(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, fi := range fields {
+		fv := rv.Field(fi.index)
+		path := prefix + fi.name
+		if fi.embedded {
+			// 组合的字段平铺在外层
+			if err = v.validateStruct(fv, prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if fi.omitEmpty && fv.IsZero() {
+			continue
+		}
+		for _, r := range fi.rules {
+			rule, _ := v.rule(r.name)
+			if !rule(Field{Name: fi.name, Value: fv, Param: r.param, Parent: rv}) {
+				*errs = append(*errs, FieldError{
+					Field:   path,
+					Rule:    r.name,
+					Param:   r.param,
+					Message: message(path, r.name, r.param),
+				})
+				// 一个字段只报告第一个失败的规则
+				break
+			}
+		}
+		if err = v.dive(fv, path, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dive 递归校验嵌套的结构体，以及切片里面的结构体
+func (v *Validator) dive(fv reflect.Value, path string, errs *Errors) error {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			return nil
+		}
+		return v.validateStruct(fv, path+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := v.dive(fv.Index(i), path+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// message 生成可读的错误信息，自定义的规则使用通用的错误信息
+func message(field string, rule string, param string) string {
+	switch rule {
+	case "required":
+		return fmt.Sprintf("%s 不能为空", field)
+	case "min":
+		return fmt.Sprintf("%s 不能小于 %s", field, param)
+	case "max":
+		return fmt.Sprintf("%s 不能大于 %s", field, param)
+	case "len":
+		return fmt.Sprintf("%s 的长度必须是 %s", field, param)
+	case "eq":
+		return fmt.Sprintf("%s 必须等于 %s", field, param)
+	case "ne":
+		return fmt.Sprintf("%s 不能等于 %s", field, param)
+	case "gt":
+		return fmt.Sprintf("%s 必须大于 %s", field, param)
+	case "gte":
+		return fmt.Sprintf("%s 必须大于等于 %s", field, param)
+	case "lt":
+		return fmt.Sprintf("%s 必须小于 %s", field, param)
+	case "lte":
+		return fmt.Sprintf("%s 必须小于等于 %s", field, param)
+	case "oneof":
+		return fmt.Sprintf("%s 必须是 [%s] 中的一个", field, param)
+	case "email":
+		return fmt.Sprintf("%s 不是合法的邮箱", field)
+	case "url":
+		return fmt.Sprintf("%s 不是合法的 URL", field)
+	case "uuid":
+		return fmt.Sprintf("%s 不是合法的 UUID", field)
+	case "alpha":
+		return fmt.Sprintf("%s 只能包含字母", field)
+	case "alphanum":
+		return fmt.Sprintf("%s 只能包含字母和数字", field)
+	case "numeric":
+		return fmt.Sprintf("%s 只能包含数字", field)
+	case "eqfield":
+		return fmt.Sprintf("%s 必须和 %s 相等", field, param)
+	case "nefield":
+		return fmt.Sprintf("%s 不能和 %s 相等", field, param)
+	case "gtfield":
+		return fmt.Sprintf("%s 必须大于 %s", field, param)
+	case "gtefield":
+		return fmt.Sprintf("%s 必须大于等于 %s", field, param)
+	case "ltfield":
+		return fmt.Sprintf("%s 必须小于 %s", field, param)
+	case "ltefield":
+		return fmt.Sprintf("%s 必须小于等于 %s", field, param)
+	}
+	return fmt.Sprintf("%s 校验规则 %s 失败", field, rule)
+}
@@ -0,0 +1,161 @@
+package validate
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signUpReq struct {
+	Email           string   `json:"email" validate:"required,email"`
+	Password        string   `json:"password" validate:"required,min=8,max=16"`
+	ConfirmPassword string   `json:"confirm_password" validate:"eqfield=Password"`
+	Role            string   `json:"role" validate:"omitempty,oneof=admin member"`
+	Age             int      `json:"age" validate:"gte=18,lt=150"`
+	Nickname        *string  `json:"nickname" validate:"omitempty,alphanum,max=8"`
+	Tags            []string `json:"tags" validate:"max=2"`
+	Address         *address `json:"address"`
+	Items           []item   `json:"items"`
+	paging
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"len=6,numeric"`
+}
+
+type item struct {
+	ID   string `json:"id" validate:"uuid"`
+	Site string `json:"site" validate:"omitempty,url"`
+}
+
+type paging struct {
+	Limit int `json:"limit" validate:"lte=100"`
+}
+
+type period struct {
+	Start time.Time     `validate:"required"`
+	End   time.Time     `validate:"gtfield=Start"`
+	TTL   time.Duration `validate:"min=1s"`
+	Code  string        `validate:"ne=000,alpha"`
+}
+
+func TestValidator_ValidateStruct(t *testing.T) {
+	nick := "tom_1"
+	now := time.Now()
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr Errors
+	}{
+		{
+			name: "valid",
+			val: &signUpReq{
+				Email:           "tom@example.com",
+				Password:        "12345678",
+				ConfirmPassword: "12345678",
+				Role:            "admin",
+				Age:             18,
+				Address:         &address{City: "Shanghai", Zip: "200000"},
+				Items:           []item{{ID: "0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11", Site: "https://example.com"}},
+			},
+		},
+		{
+			name: "invalid",
+			val: signUpReq{
+				Email:           "Tom <tom@example.com>",
+				Password:        "1234",
+				ConfirmPassword: "4321",
+				Role:            "root",
+				Age:             17,
+				Nickname:        &nick,
+				Tags:            []string{"a", "b", "c"},
+				Address:         &address{Zip: "20000a"},
+				Items:           []item{{ID: "0b6fa8b4-8b06-4f68-97c1-2d4b3f4a0c11"}, {ID: "abc", Site: "example"}},
+				paging:          paging{Limit: 101},
+			},
+			wantErr: Errors{
+				{Field: "email", Rule: "email", Message: "email 不是合法的邮箱"},
+				{Field: "password", Rule: "min", Param: "8", Message: "password 不能小于 8"},
+				{Field: "confirm_password", Rule: "eqfield", Param: "Password", Message: "confirm_password 必须和 Password 相等"},
+				{Field: "role", Rule: "oneof", Param: "admin member", Message: "role 必须是 [admin member] 中的一个"},
+				{Field: "age", Rule: "gte", Param: "18", Message: "age 必须大于等于 18"},
+				{Field: "nickname", Rule: "alphanum", Message: "nickname 只能包含字母和数字"},
+				{Field: "tags", Rule: "max", Param: "2", Message: "tags 不能大于 2"},
+				{Field: "address.city", Rule: "required", Message: "address.city 不能为空"},
+				{Field: "address.zip", Rule: "numeric", Message: "address.zip 只能包含数字"},
+				{Field: "items[1].id", Rule: "uuid", Message: "items[1].id 不是合法的 UUID"},
+				{Field: "items[1].site", Rule: "url", Message: "items[1].site 不是合法的 URL"},
+				{Field: "limit", Rule: "lte", Param: "100", Message: "limit 必须小于等于 100"},
+			},
+		},
+		{
+			name: "time and duration",
+			val:  &period{Start: now, End: now, TTL: time.Millisecond, Code: "000"},
+			wantErr: Errors{
+				{Field: "End", Rule: "gtfield", Param: "Start", Message: "End 必须大于 Start"},
+				{Field: "TTL", Rule: "min", Param: "1s", Message: "TTL 不能小于 1s"},
+				{Field: "Code", Rule: "ne", Param: "000", Message: "Code 不能等于 000"},
+			},
+		},
+		{
+			name: "valid time and duration",
+			val:  &period{Start: now, End: now.Add(time.Hour), TTL: time.Second, Code: "abc"},
+		},
+		{
+			name: "not struct",
+			val:  new(int),
+		},
+		{
+			name: "nil pointer",
+			val:  (*signUpReq)(nil),
+		},
+	}
+
+	v := New()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.ValidateStruct(tc.val)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			assert.Equal(t, tc.wantErr, errs)
+		})
+	}
+}
+
+func TestValidator_RegisterRule(t *testing.T) {
+	v := New()
+	type req struct {
+		Name string `validate:"lowercase"`
+	}
+	err := v.ValidateStruct(req{Name: "Tom"})
+	assert.EqualError(t, err, "validate: 未知的规则 lowercase，字段 req.Name")
+
+	v = New()
+	v.RegisterRule("lowercase", func(f Field) bool {
+		return f.Value.Kind() == reflect.String && strings.ToLower(f.Value.String()) == f.Value.String()
+	})
+	assert.NoError(t, v.ValidateStruct(req{Name: "tom"}))
+	err = v.ValidateStruct(req{Name: "Tom"})
+	assert.Equal(t, Errors{{Field: "Name", Rule: "lowercase", Message: "Name 校验规则 lowercase 失败"}}, err)
+	assert.EqualError(t, err, "validate: Name 校验规则 lowercase 失败")
+
+	// 自定义的跨字段规则
+	type rangeReq struct {
+		Min int
+		Max int `validate:"after=Min"`
+	}
+	v.RegisterRule("after", func(f Field) bool {
+		return f.Value.Int() > f.Parent.FieldByName(f.Param).Int()
+	})
+	assert.NoError(t, v.ValidateStruct(rangeReq{Min: 1, Max: 2}))
+	assert.Error(t, v.ValidateStruct(rangeReq{Min: 2, Max: 1}))
+}
@@ -0,0 +1,28 @@
+package kyuu
+
+import "github.com/coderi421/kyuu/validate"
+
+// Validator 在 Bind 和 BindJSON 之后校验数据
+// 默认不校验，通过 ServerWithValidator 开启，例如 ServerWithValidator(validate.Default)
+// 已有的结构体上的 validate 标签可能是给别的校验库用的，所以不能默认开启
+type Validator interface {
+	// ValidateStruct 校验结构体，校验失败的时候返回 error
+	ValidateStruct(val any) error
+}
+
+var _ Validator = (*validate.Validator)(nil)
+
+// ServerWithValidator 设置 Bind 和 BindJSON 使用的 Validator，设置之后绑定成功的数据都会被校验
+func ServerWithValidator(v Validator) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.validator = v
+	}
+}
+
+// validate 使用 server 上的 Validator 校验数据，没有设置的时候不校验
+func (c *Context) validate(val any) error {
+	if c.validator == nil {
+		return nil
+	}
+	return c.validator.ValidateStruct(val)
+}
@@ -0,0 +1,436 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType 帧的操作码
+type MessageType int
+
+const (
+	continuationFrame MessageType = 0
+	// TextMessage 文本消息，内容必须是合法的 UTF-8
+	TextMessage MessageType = 1
+	// BinaryMessage 二进制消息
+	BinaryMessage MessageType = 2
+	// CloseMessage 关闭帧
+	CloseMessage MessageType = 8
+	// PingMessage ping 帧，收到之后会自动回复 pong
+	PingMessage MessageType = 9
+	// PongMessage pong 帧
+	PongMessage MessageType = 10
+)
+
+func (t MessageType) isControl() bool {
+	return t >= CloseMessage
+}
+
+func (t MessageType) isValid() bool {
+	switch t {
+	case continuationFrame, TextMessage, BinaryMessage, CloseMessage, PingMessage, PongMessage:
+		return true
+	}
+	return false
+}
+
+// 关闭码，参考 RFC 6455 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// 控制帧的负载不能超过 125 字节
+const maxControlPayload = 125
+
+// ErrCloseSent 已经发送了关闭帧，不能再发送数据
+var ErrCloseSent = errors.New("websocket: 已经发送了关闭帧")
+
+// CloseError 连接被关闭
+// 可能是对端主动关闭，也可能是对端违反了协议，被我们关闭
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: 连接关闭 %d %s", e.Code, e.Text)
+}
+
+// Conn 一个 WebSocket 连接
+// 同一时刻只允许一个 goroutine 读，但是可以有多个 goroutine 同时写
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// 保护写操作，读的过程中回复 pong、close 也需要写
+	writeMutex sync.Mutex
+	bw         *bufio.Writer
+	closeSent  bool
+
+	subprotocol string
+	// 一条消息（所有分片加起来）的最大长度
+	maxMessageSize int64
+	// 发送消息的时候，超过这个大小就会拆分成多个分片，0 代表不拆分
+	writeFrameSize int
+
+	// 读出错之后，连接就不能再读了，之后的读都返回这个错误
+	readErr     error
+	pongHandler func(data []byte)
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, bw *bufio.Writer) *Conn {
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		bw:             bw,
+		maxMessageSize: defaultMaxMessageSize,
+	}
+}
+
+// Subprotocol 握手时协商出来的子协议
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr 对端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler 收到 pong 的时候回调，一般用来配合 Ping 做心跳检测
+func (c *Conn) SetPongHandler(fn func(data []byte)) {
+	c.pongHandler = fn
+}
+
+// ReadMessage 读取一条完整的消息
+// ping、pong、close 之类的控制帧会在内部处理掉：
+// 收到 ping 自动回复 pong；收到 close 回复 close，并且返回 *CloseError
+// 分片的消息会被合并成一条返回
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	typ, data, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return typ, data, err
+}
+
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var buf []byte
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch f.opcode {
+		case PingMessage:
+			if err = c.WriteControl(PongMessage, f.payload); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if c.pongHandler != nil {
+				c.pongHandler(f.payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(f.payload)
+		case continuationFrame:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "收到了没有起始帧的分片")
+			}
+		default:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "上一条分片消息还没有结束")
+			}
+			typ = f.opcode
+		}
+
+		if int64(len(buf)+len(f.payload)) > c.maxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "消息过大")
+		}
+		buf = append(buf, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if typ == TextMessage && !utf8.Valid(buf) {
+			return 0, nil, c.fail(CloseInvalidFramePayloadData, "文本消息不是合法的 UTF-8")
+		}
+		return typ, buf, nil
+	}
+}
+
+type frame struct {
+	fin     bool
+	opcode  MessageType
+	payload []byte
+}
+
+// readFrame 读取一个帧，参考 RFC 6455 5.2
+//
+//	0                   1                   2                   3
+//	0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-------+-+-------------+-------------------------------+
+//	|F|R|R|R| opcode|M| Payload len |    Extended payload length    |
+//	|I|S|S|S|  (4)  |A|     (7)     |             (16/64)           |
+//	|N|V|V|V|       |S|             |   (if payload len==126/127)   |
+//	| |1|2|3|       |K|             |                               |
+//	+-+-+-+-+-------+-+-------------+ - - - - - - - - - - - - - - - +
+func (c *Conn) readFrame() (frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		fin:    head[0]&0x80 != 0,
+		opcode: MessageType(head[0] & 0x0f),
+	}
+	// 没有协商任何扩展，所以 RSV 必须都是 0
+	if head[0]&0x70 != 0 {
+		return f, c.fail(CloseProtocolError, "保留位必须为 0")
+	}
+	if !f.opcode.isValid() {
+		return f, c.fail(CloseProtocolError, "未知的操作码")
+	}
+	if head[1]&0x80 == 0 {
+		return f, c.fail(CloseProtocolError, "客户端发送的帧必须使用掩码")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		l := binary.BigEndian.Uint64(ext[:])
+		// 最高位必须是 0
+		if l>>63 != 0 {
+			return f, c.fail(CloseProtocolError, "帧长度非法")
+		}
+		length = int64(l)
+	}
+
+	if f.opcode.isControl() {
+		if !f.fin {
+			return f, c.fail(CloseProtocolError, "控制帧不允许分片")
+		}
+		if length > maxControlPayload {
+			return f, c.fail(CloseProtocolError, "控制帧过大")
+		}
+	}
+	// 分配内存之前先检查长度
+	if length > c.maxMessageSize {
+		return f, c.fail(CloseMessageTooBig, "消息过大")
+	}
+
+	var key [4]byte
+	if _, err := io.ReadFull(c.br, key[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	maskBytes(key, f.payload)
+	return f, nil
+}
+
+func maskBytes(key [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
+
+// handleClose 处理对端发过来的关闭帧，回复关闭帧之后关闭连接
+func (c *Conn) handleClose(payload []byte) error {
+	switch {
+	case len(payload) == 0:
+		_ = c.writeClose(nil)
+		_ = c.conn.Close()
+		return &CloseError{Code: CloseNoStatusReceived}
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "关闭帧的负载非法")
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	if !isValidReceivedCloseCode(code) {
+		return c.fail(CloseProtocolError, "非法的关闭码")
+	}
+	reason := payload[2:]
+	if !utf8.Valid(reason) {
+		return c.fail(CloseInvalidFramePayloadData, "关闭原因不是合法的 UTF-8")
+	}
+	_ = c.writeClose(formatClose(code, ""))
+	_ = c.conn.Close()
+	return &CloseError{Code: code, Text: string(reason)}
+}
+
+// isValidReceivedCloseCode 1005、1006 之类的关闭码只在本地使用，不允许出现在关闭帧里面
+func isValidReceivedCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail 对端违反了协议，发送关闭帧之后直接关闭连接
+func (c *Conn) fail(code int, text string) error {
+	_ = c.writeClose(formatClose(code, text))
+	_ = c.conn.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+func formatClose(code int, text string) []byte {
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	if len(buf) > maxControlPayload {
+		buf = buf[:maxControlPayload]
+	}
+	return buf
+}
+
+// WriteMessage 发送一条文本或者二进制消息
+// 如果设置了分片大小，超过的消息会被拆分成多个帧发送
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: 非法的消息类型 %d", typ)
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	opcode := typ
+	for {
+		chunk := data
+		if c.writeFrameSize > 0 && len(chunk) > c.writeFrameSize {
+			chunk = chunk[:c.writeFrameSize]
+		}
+		data = data[len(chunk):]
+		c.writeFrame(len(data) == 0, opcode, chunk)
+		if len(data) == 0 {
+			break
+		}
+		opcode = continuationFrame
+	}
+	return c.bw.Flush()
+}
+
+// WriteControl 发送控制帧，负载不能超过 125 字节
+func (c *Conn) WriteControl(typ MessageType, data []byte) error {
+	if !typ.isControl() {
+		return fmt.Errorf("websocket: 非法的控制帧类型 %d", typ)
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: 控制帧过大")
+	}
+	if typ == CloseMessage {
+		return c.writeClose(data)
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	c.writeFrame(true, typ, data)
+	return c.bw.Flush()
+}
+
+// Ping 发送 ping，对端回复的 pong 交给 SetPongHandler 设置的回调处理
+func (c *Conn) Ping(data []byte) error {
+	return c.WriteControl(PingMessage, data)
+}
+
+// Close 发送关闭帧，并且关闭底层连接
+// 重复调用是安全的
+func (c *Conn) Close(code int, reason string) error {
+	err := c.writeClose(formatClose(code, reason))
+	if err == ErrCloseSent {
+		err = nil
+	}
+	if er := c.conn.Close(); er != nil && err == nil && !errors.Is(er, net.ErrClosed) {
+		err = er
+	}
+	return err
+}
+
+// writeClose 关闭帧只能发送一次
+func (c *Conn) writeClose(payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	c.closeSent = true
+	c.writeFrame(true, CloseMessage, payload)
+	return c.bw.Flush()
+}
+
+// writeFrame 服务端发送的帧不需要掩码
+// 调用者需要持有 writeMutex 并且负责 Flush
+func (c *Conn) writeFrame(fin bool, opcode MessageType, payload []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	length := len(payload)
+	var head [10]byte
+	head[0] = b0
+	n := 2
+	switch {
+	case length <= 125:
+		head[1] = byte(length)
+	case length <= 0xffff:
+		head[1] = 126
+		binary.BigEndian.PutUint16(head[2:], uint16(length))
+		n += 2
+	default:
+		head[1] = 127
+		binary.BigEndian.PutUint64(head[2:], uint64(length))
+		n += 8
+	}
+	// 写入 bufio.Writer 的错误会在 Flush 的时候返回
+	_, _ = c.bw.Write(head[:n])
+	_, _ = c.bw.Write(payload)
+}
@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"github.com/coderi421/kyuu"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 参考 RFC 6455 1.3，用于计算 Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const defaultMaxMessageSize = 32 << 20
+
+// HandleFunc 升级成功之后的业务逻辑
+// 返回之后连接会被关闭
+type HandleFunc func(ctx *kyuu.Context, conn *Conn)
+
+// Upgrader 负责将 HTTP 请求升级为 WebSocket 连接
+// 升级是在路由的 HandleFunc 里面完成的，所以路径参数、鉴权、session 之类的 middleware 都会先执行
+type Upgrader struct {
+	// CheckOrigin 校验 Origin，返回 false 会拒绝握手
+	// 为 nil 的时候，要求 Origin 和 Host 一致，防止跨站的 WebSocket 劫持
+	CheckOrigin func(req *http.Request) bool
+	// Subprotocols 服务端支持的子协议，按照优先级排序
+	Subprotocols []string
+	// MaxMessageSize 一条消息的最大长度，0 代表使用默认的 32MB
+	// 帧的长度是客户端声明的，所以必须有上限，否则一个帧头就能让服务端分配巨大的内存
+	MaxMessageSize int64
+	// WriteFrameSize 发送消息的时候，超过这个大小就拆分成多个分片，0 代表不拆分
+	WriteFrameSize int
+}
+
+var defaultUpgrader = &Upgrader{}
+
+// Upgrade 使用默认配置升级连接
+func Upgrade(ctx *kyuu.Context) (*Conn, error) {
+	return defaultUpgrader.Upgrade(ctx)
+}
+
+// Handle 使用默认配置，返回一个可以直接注册为路由的 HandleFunc
+//
+//	server.Get("/ws/:room", websocket.Handle(func(ctx *kyuu.Context, conn *websocket.Conn) {
+//		room, _ := ctx.PathValue("room").String()
+//		...
+//	}))
+func Handle(fn HandleFunc) kyuu.HandleFunc {
+	return defaultUpgrader.Handle(fn)
+}
+
+// Handle 返回一个可以直接注册为路由的 HandleFunc
+// 握手失败的时候，会设置好响应码，不会执行 fn
+func (u *Upgrader) Handle(fn HandleFunc) kyuu.HandleFunc {
+	return func(ctx *kyuu.Context) {
+		conn, err := u.Upgrade(ctx)
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close(CloseNormalClosure, "")
+		}()
+		fn(ctx, conn)
+	}
+}
+
+// Upgrade 完成握手，参考 RFC 6455 4.2
+// 握手失败的时候，会将响应码和错误信息设置到 ctx 上，并且返回 error
+// 握手成功之后，ctx.Resp.Header() 里面已经设置的响应头（例如 Set-Cookie）也会一并发送
+func (u *Upgrader) Upgrade(ctx *kyuu.Context) (*Conn, error) {
+	req := ctx.Req
+	if req.Method != http.MethodGet {
+		return nil, u.reject(ctx, http.StatusMethodNotAllowed, "websocket: 握手必须使用 GET 方法")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") {
+		return nil, u.reject(ctx, http.StatusBadRequest, "websocket: Connection 头部缺少 upgrade")
+	}
+	if !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return nil, u.reject(ctx, http.StatusBadRequest, "websocket: Upgrade 头部缺少 websocket")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Resp.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, u.reject(ctx, http.StatusUpgradeRequired, "websocket: 只支持版本 13")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, u.reject(ctx, http.StatusBadRequest, "websocket: Sec-WebSocket-Key 非法")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, u.reject(ctx, http.StatusForbidden, "websocket: Origin 校验失败")
+	}
+	subprotocol := u.selectSubprotocol(req)
+
+	netConn, rw, err := ctx.Hijack()
+	if err != nil {
+		return nil, u.reject(ctx, http.StatusInternalServerError, err.Error())
+	}
+	// 让 accesslog、prometheus 之类的 middleware 能够拿到响应码
+	ctx.RespStatusCode = http.StatusSwitchingProtocols
+
+	header := ctx.Resp.Header().Clone()
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", computeAccept(key))
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	header.Del("Content-Length")
+	header.Del("Content-Type")
+
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(rw.Writer)
+	_, _ = rw.WriteString("\r\n")
+	if err = rw.Flush(); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	conn := newConn(netConn, rw.Reader, rw.Writer)
+	conn.subprotocol = subprotocol
+	if u.MaxMessageSize > 0 {
+		conn.maxMessageSize = u.MaxMessageSize
+	}
+	conn.writeFrameSize = u.WriteFrameSize
+	return conn, nil
+}
+
+func (u *Upgrader) reject(ctx *kyuu.Context, code int, msg string) error {
+	ctx.RespStatusCode = code
+	ctx.RespData = []byte(msg)
+	return errors.New(msg)
+}
+
+// selectSubprotocol 按照服务端的优先级，选出第一个客户端也支持的子协议
+func (u *Upgrader) selectSubprotocol(req *http.Request) string {
+	if len(u.Subprotocols) == 0 {
+		return ""
+	}
+	clientProtocols := headerTokens(req.Header, "Sec-WebSocket-Protocol")
+	for _, sp := range u.Subprotocols {
+		for _, cp := range clientProtocols {
+			if sp == cp {
+				return sp
+			}
+		}
+	}
+	return ""
+}
+
+func computeAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	// 非浏览器的客户端一般不会带 Origin
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTokens 头部的值可能是逗号分隔的多个 token，例如 Connection: keep-alive, Upgrade
+func headerTokens(header http.Header, name string) []string {
+	var res []string
+	for _, val := range header.Values(name) {
+		for _, t := range strings.Split(val, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				res = append(res, t)
+			}
+		}
+	}
+	return res
+}
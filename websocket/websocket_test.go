@@ -0,0 +1,340 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/coderi421/kyuu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgrader_Handle(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Use(func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			ctx.Resp.Header().Set("X-Middleware", "executed")
+			next(ctx)
+		}
+	})
+	auth := func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			if ctx.Req.URL.Query().Get("token") != "123" {
+				ctx.RespStatusCode = http.StatusUnauthorized
+				return
+			}
+			next(ctx)
+		}
+	}
+	upgrader := &Upgrader{Subprotocols: []string{"chat", "json"}, MaxMessageSize: 16, WriteFrameSize: 10}
+	s.Group("/ws", auth).Get("/:room", upgrader.Handle(func(ctx *kyuu.Context, conn *Conn) {
+		room, _ := ctx.PathValue("room").String()
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(typ, []byte(room+":"+string(data))); err != nil {
+				return
+			}
+		}
+	}))
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	t.Run("echo", func(t *testing.T) {
+		conn, br, resp := dial(t, server, "/ws/lobby?token=123", http.Header{
+			"Sec-WebSocket-Protocol": {"json, chat"},
+		})
+		defer conn.Close()
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+		assert.Equal(t, "chat", resp.Header.Get("Sec-WebSocket-Protocol"))
+		assert.Equal(t, "executed", resp.Header.Get("X-Middleware"))
+
+		writeFrame(t, conn, true, true, TextMessage, []byte("hi"))
+		assertMessage(t, br, TextMessage, "lobby:hi")
+
+		// 分片消息，中间夹着 ping
+		writeFrame(t, conn, false, true, BinaryMessage, []byte("ab"))
+		writeFrame(t, conn, true, true, PingMessage, []byte("ping"))
+		writeFrame(t, conn, true, true, continuationFrame, []byte("cd"))
+		fin, opcode, payload := readFrame(t, br)
+		assert.True(t, fin)
+		assert.Equal(t, PongMessage, opcode)
+		assert.Equal(t, "ping", string(payload))
+		assertMessage(t, br, BinaryMessage, "lobby:abcd")
+
+		writeFrame(t, conn, true, true, CloseMessage, formatClose(CloseNormalClosure, "bye"))
+		fin, opcode, payload = readFrame(t, br)
+		assert.True(t, fin)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseNormalClosure, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	testCases := []struct {
+		name     string
+		send     func(t *testing.T, conn net.Conn)
+		wantCode int
+	}{
+		{
+			name: "unmasked",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, true, false, TextMessage, []byte("hi"))
+			},
+			wantCode: CloseProtocolError,
+		},
+		{
+			name: "invalid utf8",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, true, true, TextMessage, []byte{0xff, 0xfe})
+			},
+			wantCode: CloseInvalidFramePayloadData,
+		},
+		{
+			name: "too big",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, false, true, TextMessage, []byte("0123456789"))
+				writeFrame(t, conn, true, true, continuationFrame, []byte("0123456789"))
+			},
+			wantCode: CloseMessageTooBig,
+		},
+		{
+			name: "continuation without start",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, true, true, continuationFrame, []byte("hi"))
+			},
+			wantCode: CloseProtocolError,
+		},
+		{
+			name: "fragmented control frame",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, false, true, PingMessage, []byte("hi"))
+			},
+			wantCode: CloseProtocolError,
+		},
+		{
+			name: "invalid close code",
+			send: func(t *testing.T, conn net.Conn) {
+				writeFrame(t, conn, true, true, CloseMessage, formatClose(CloseAbnormalClosure, ""))
+			},
+			wantCode: CloseProtocolError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, br, _ := dial(t, server, "/ws/lobby?token=123", nil)
+			defer conn.Close()
+			tc.send(t, conn)
+			_, opcode, payload := readFrame(t, br)
+			assert.Equal(t, CloseMessage, opcode)
+			assert.Equal(t, tc.wantCode, int(binary.BigEndian.Uint16(payload)))
+		})
+	}
+
+	t.Run("fragmented write", func(t *testing.T) {
+		conn, br, _ := dial(t, server, "/ws/lobby?token=123", nil)
+		defer conn.Close()
+		writeFrame(t, conn, true, true, TextMessage, []byte("hello"))
+		fin, opcode, payload := readFrame(t, br)
+		assert.False(t, fin)
+		assert.Equal(t, TextMessage, opcode)
+		assert.Equal(t, "lobby:hell", string(payload))
+		fin, opcode, payload = readFrame(t, br)
+		assert.True(t, fin)
+		assert.Equal(t, continuationFrame, opcode)
+		assert.Equal(t, "o", string(payload))
+	})
+}
+
+func TestUpgrader_Reject(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Get("/ws", Handle(func(ctx *kyuu.Context, conn *Conn) {
+		t.Fatal("握手失败的时候不应该执行")
+	}))
+	s.Post("/ws", Handle(func(ctx *kyuu.Context, conn *Conn) {
+		t.Fatal("握手失败的时候不应该执行")
+	}))
+
+	validHeader := func() http.Header {
+		return http.Header{
+			"Connection":            {"keep-alive, Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		}
+	}
+	testCases := []struct {
+		name     string
+		method   string
+		header   func() http.Header
+		wantCode int
+	}{
+		{
+			name:     "post",
+			method:   http.MethodPost,
+			header:   validHeader,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "no upgrade",
+			method: http.MethodGet,
+			header: func() http.Header {
+				h := validHeader()
+				h.Del("Upgrade")
+				return h
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "version",
+			method: http.MethodGet,
+			header: func() http.Header {
+				h := validHeader()
+				h.Set("Sec-Websocket-Version", "8")
+				return h
+			},
+			wantCode: http.StatusUpgradeRequired,
+		},
+		{
+			name:   "key",
+			method: http.MethodGet,
+			header: func() http.Header {
+				h := validHeader()
+				h.Set("Sec-Websocket-Key", "abc")
+				return h
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:   "origin",
+			method: http.MethodGet,
+			header: func() http.Header {
+				h := validHeader()
+				h.Set("Origin", "https://evil.com")
+				return h
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			// ResponseRecorder 不支持 Hijack
+			name:     "hijack",
+			method:   http.MethodGet,
+			header:   validHeader,
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/ws", nil)
+			req.Header = tc.header()
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestUpgrader_DeclaredLengthTooBig(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Get("/ws", Handle(func(ctx *kyuu.Context, conn *Conn) {
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+	}))
+	server := httptest.NewServer(s)
+	defer server.Close()
+	conn, br, _ := dial(t, server, "/ws", nil)
+	defer conn.Close()
+
+	// 只发送帧头，声明 1TB 的长度，默认的上限会在分配内存之前拒绝
+	head := []byte{0x80 | byte(BinaryMessage), 0x80 | 127}
+	head = binary.BigEndian.AppendUint64(head, 1<<40)
+	head = append(head, 1, 2, 3, 4)
+	_, err := conn.Write(head)
+	require.NoError(t, err)
+	_, opcode, payload := readFrame(t, br)
+	assert.Equal(t, CloseMessage, opcode)
+	assert.Equal(t, CloseMessageTooBig, int(binary.BigEndian.Uint16(payload)))
+}
+
+func TestUpgrader_RejectedByMiddleware(t *testing.T) {
+	s := kyuu.NewHTTPServer()
+	s.Group("/ws", func(next kyuu.HandleFunc) kyuu.HandleFunc {
+		return func(ctx *kyuu.Context) {
+			ctx.RespStatusCode = http.StatusUnauthorized
+		}
+	}).Get("/chat", Handle(func(ctx *kyuu.Context, conn *Conn) {
+		t.Fatal("没有通过鉴权不应该升级")
+	}))
+	server := httptest.NewServer(s)
+	defer server.Close()
+	conn, _, resp := dial(t, server, "/ws/chat", nil)
+	defer conn.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func dial(t *testing.T, server *httptest.Server, path string, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second*3)))
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	require.NoError(t, req.Write(conn))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	require.NoError(t, err)
+	return conn, br, resp
+}
+
+func writeFrame(t *testing.T, conn net.Conn, fin bool, masked bool, opcode MessageType, payload []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	buf := []byte{b0, byte(len(payload))}
+	data := append([]byte{}, payload...)
+	if masked {
+		buf[1] |= 0x80
+		key := [4]byte{1, 2, 3, 4}
+		buf = append(buf, key[:]...)
+		maskBytes(key, data)
+	}
+	_, err := conn.Write(append(buf, data...))
+	require.NoError(t, err)
+}
+
+func readFrame(t *testing.T, br *bufio.Reader) (bool, MessageType, []byte) {
+	var head [2]byte
+	_, err := br.Read(head[:1])
+	require.NoError(t, err)
+	_, err = br.Read(head[1:])
+	require.NoError(t, err)
+	// 服务端的帧不会使用掩码，测试里面的消息都很短
+	require.Equal(t, byte(0), head[1]&0x80)
+	payload := make([]byte, head[1]&0x7f)
+	for read := 0; read < len(payload); {
+		n, er := br.Read(payload[read:])
+		require.NoError(t, er)
+		read += n
+	}
+	return head[0]&0x80 != 0, MessageType(head[0] & 0x0f), payload
+}
+
+func assertMessage(t *testing.T, br *bufio.Reader, wantType MessageType, want string) {
+	fin, opcode, payload := readFrame(t, br)
+	assert.True(t, fin)
+	assert.Equal(t, wantType, opcode)
+	assert.Equal(t, want, string(payload))
+}